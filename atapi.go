@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultATDeny blocks commands that take the modem offline, write NV items
+// or touch the firmware
+const defaultATDeny = "AT+CFUN=0,AT+CFUN=4,AT^NVWR,AT^NVWREX,AT^DLOAD,AT^GODLOAD,AT^DATALOCK,AT^SETPORT"
+
+// ATPolicy decides which commands may be issued through the API
+type ATPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// NewATPolicy builds a policy from comma-separated command prefixes. An empty
+// allowlist allows everything that is not denied.
+func NewATPolicy(allow, deny string) *ATPolicy {
+	return &ATPolicy{
+		allow: splitPrefixes(allow),
+		deny:  splitPrefixes(deny),
+	}
+}
+
+func splitPrefixes(list string) []string {
+	var prefixes []string
+	for _, p := range strings.Split(list, ",") {
+		if p = normalizeAT(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+func normalizeAT(command string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(command), ""))
+}
+
+// Check returns an error if any command of a (possibly chained) command line
+// is not permitted
+func (p *ATPolicy) Check(command string) error {
+	if strings.ContainsAny(command, "\r\n\x1a\x1b") {
+		return errors.New("control characters are not allowed")
+	}
+
+	normalized := normalizeAT(command)
+	if !strings.HasPrefix(normalized, "AT") {
+		return fmt.Errorf("not an AT command: %q", command)
+	}
+
+	// "AT+CSQ;+CFUN=0" and "ATE0+CFUN=0" both run two commands; check each
+	// on its own
+	parts, err := splitATCommands(normalized[2:])
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		parts = []string{"AT"}
+	}
+	for _, part := range parts {
+		for _, prefix := range p.deny {
+			if strings.HasPrefix(part, prefix) {
+				return fmt.Errorf("%s is denied", part)
+			}
+		}
+		if len(p.allow) == 0 {
+			continue
+		}
+		allowed := false
+		for _, prefix := range p.allow {
+			if strings.HasPrefix(part, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s is not in the allowlist", part)
+		}
+	}
+	return nil
+}
+
+// splitATCommands splits a normalized command line, without its "AT", into
+// its commands, each with "AT" put back in front. Per V.250 basic commands
+// such as "E0" or "&F" run together without separators, and an extended
+// "+" or "^" command may follow them directly. An extended command ends at
+// the next ";", "+" or "^" outside quotes, since some firmware starts a new
+// command there too. A dial command takes the rest of the line.
+func splitATCommands(line string) ([]string, error) {
+	var commands []string
+	for len(line) > 0 {
+		n := 0
+		switch c := line[0]; {
+		case c == ';':
+			line = line[1:]
+			continue
+		case c == '+' || c == '^':
+			quoted := false
+			for n = 1; n < len(line); n++ {
+				if line[n] == '"' {
+					quoted = !quoted
+				} else if !quoted && strings.IndexByte(";+^", line[n]) >= 0 {
+					break
+				}
+			}
+		case c == 'D':
+			n = strings.IndexByte(line, ';')
+			if n < 0 {
+				n = len(line)
+			}
+		case c == '&' || c >= 'A' && c <= 'Z':
+			n = 1
+			if c == '&' {
+				if len(line) < 2 || line[1] < 'A' || line[1] > 'Z' {
+					return nil, fmt.Errorf("malformed command line at %q", line)
+				}
+				n = 2
+			}
+			for n < len(line) && strings.IndexByte("0123456789=?", line[n]) >= 0 {
+				n++
+			}
+		default:
+			return nil, fmt.Errorf("malformed command line at %q", line)
+		}
+		commands = append(commands, "AT"+line[:n])
+		line = line[n:]
+	}
+	return commands, nil
+}
+
+// atAuditRecord is one line of the AT command audit trail
+type atAuditRecord struct {
+	Time       time.Time `json:"time"`
+	Modem      string    `json:"modem"`
+	Remote     string    `json:"remote"`
+	Command    string    `json:"command"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// atAuditor writes every API command to the log and, optionally, to an
+// append-only JSON lines file
+type atAuditor struct {
+	logger *log.Logger
+	mu     sync.Mutex
+	file   *os.File
+}
+
+func newATAuditor(path string, logger *log.Logger) (*atAuditor, error) {
+	a := &atAuditor{logger: logger}
+	if path == "" {
+		return a, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AT audit log: %v", err)
+	}
+	a.file = file
+	return a, nil
+}
+
+func (a *atAuditor) Record(rec atAuditRecord) {
+	a.logger.Printf("AUDIT: %s [%s] %s -> %s %s (%d ms)",
+		rec.Remote, rec.Modem, rec.Command, rec.Status, rec.Error, rec.DurationMs)
+
+	if a.file == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		a.logger.Printf("WARN: Failed to write AT audit log: %v", err)
+	}
+}
+
+func (a *atAuditor) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// atRequest is the body of POST /api/at
+type atRequest struct {
+	Command string `json:"command"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// atResponse is returned by POST /api/at
+type atResponse struct {
+	Command    string   `json:"command"`
+	Status     string   `json:"status"`
+	Lines      []string `json:"lines"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+func (s *Server) handleATAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	var req atRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Command = strings.TrimSpace(req.Command)
+
+	timeout := s.config.ATTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 || d > time.Minute {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+	// The command may outlast the server's WriteTimeout
+	s.extendWriteDeadline(w, timeout)
+
+	resp := atResponse{Command: req.Command, Lines: []string{}}
+	code := http.StatusOK
+	start := time.Now()
+
+	if err := s.atPolicy.Check(req.Command); err != nil {
+		resp.Status = "denied"
+		resp.Error = err.Error()
+		code = http.StatusForbidden
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		lines, err := m.Client.SendAT(ctx, req.Command)
+		cancel()
+
+		resp.Lines = append(resp.Lines, lines...)
+		resp.Status, code = atStatus(err)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+
+	s.atAudit.Record(atAuditRecord{
+		Time:       start,
+		Modem:      m.ID,
+		Remote:     r.RemoteAddr,
+		Command:    req.Command,
+		Status:     resp.Status,
+		Error:      resp.Error,
+		DurationMs: resp.DurationMs,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// atStatus maps a SendAT error to an API status and HTTP code. Errors
+// reported by the modem itself are a successful API call.
+func atStatus(err error) (string, int) {
+	var cme *CMEError
+	var cms *CMSError
+	switch {
+	case err == nil:
+		return "ok", http.StatusOK
+	case errors.Is(err, ErrATError), errors.Is(err, ErrATNotSupported),
+		errors.As(err, &cme), errors.As(err, &cms):
+		return "error", http.StatusOK
+	case errors.Is(err, ErrATTimeout):
+		return "timeout", http.StatusGatewayTimeout
+	default:
+		return "unavailable", http.StatusServiceUnavailable
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestATPolicyCheck(t *testing.T) {
+	policy := NewATPolicy("", defaultATDeny)
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"AT", true},
+		{"AT+CSQ", true},
+		{"at+cfun?", true},
+		{"AT+CSQ;^HCSQ?", true},
+		{`AT+CUSD=1,"*100#;+CFUN=0",15`, true},
+		{"ATE0V1", true},
+		{"ATD*99#", true},
+		{"AT+CFUN=0", false},
+		{"at + cfun = 4", false},
+		{"AT+CSQ;+CFUN=0", false},
+		{"ATE0+CFUN=0", false},
+		{"AT&F+CFUN=4", false},
+		{"ATZ^NVWR=50502,1", false},
+		{"ATE0;^NVWREX=1", false},
+		{"AT+CSQ+CFUN=0", false},
+		{"ATD*99#;+CFUN=0", false},
+		{"AT+CSQ\r+CFUN=0", false},
+		{"ATE0,+CFUN=0", false},
+		{"+CSQ", false},
+	}
+	for _, tt := range tests {
+		if err := policy.Check(tt.command); (err == nil) != tt.allowed {
+			t.Errorf("Check(%q) = %v, want allowed %v", tt.command, err, tt.allowed)
+		}
+	}
+}
+
+func TestATPolicyAllowlist(t *testing.T) {
+	policy := NewATPolicy("AT+CSQ,AT^HCSQ,ATE", "")
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"AT+CSQ", true},
+		{"ATE0^HCSQ?", true},
+		{"AT", false},
+		{"ATE0+COPS=2", false},
+		{"AT&F", false},
+	}
+	for _, tt := range tests {
+		if err := policy.Check(tt.command); (err == nil) != tt.allowed {
+			t.Errorf("Check(%q) = %v, want allowed %v", tt.command, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by SendAT
+var (
+	ErrATError        = errors.New("AT command returned ERROR")
+	ErrATNotSupported = errors.New("AT command not supported")
+	ErrATTimeout      = errors.New("AT command timed out")
+)
+
+// CMEError is a +CME ERROR final result (mobile equipment error)
+type CMEError struct {
+	Code int
+	Text string
+}
+
+func (e *CMEError) Error() string {
+	if e.Text != "" {
+		return "+CME ERROR: " + e.Text
+	}
+	return fmt.Sprintf("+CME ERROR: %d", e.Code)
+}
+
+// CMSError is a +CMS ERROR final result (message service error)
+type CMSError struct {
+	Code int
+	Text string
+}
+
+func (e *CMSError) Error() string {
+	if e.Text != "" {
+		return "+CMS ERROR: " + e.Text
+	}
+	return fmt.Sprintf("+CMS ERROR: %d", e.Code)
+}
+
+// unsolicitedPrefixes are result lines the modem may emit at any time. They
+// are never collected into a command response unless the command itself
+// queries that prefix.
+var unsolicitedPrefixes = []string{
+	"^RSSI:", "^HCSQ:", "^DSFLOWRPT:", "^BOOT:", "^MODE:", "^SRVST:", "^SIMST:",
+	"^NDISSTAT:", "^CEND:", "^CONN:", "^ORIG:", "^CONF:", "^RSSILVL:", "^STIN:",
+	"+CMTI:", "+CMT:", "+CDS:", "+CDSI:", "+CUSD:", "+CREG:", "+CGREG:", "+CEREG:",
+	"^HFREQINFO:",
+}
+
+// atCommand is the command currently waiting for its final result
+type atCommand struct {
+	command string
+	prefix  string
+	lines   []string
+	done    chan error
+	prompt  chan struct{} // signalled on "> " when the command takes data
+}
+
+// SendAT writes an AT command to the modem and collects the response lines up
+// to the final result code. Commands are serialized; each is bounded by the
+// context deadline or, when there is none, by Config.ATTimeout.
+func (w *WebSocketClient) SendAT(ctx context.Context, command string) ([]string, error) {
+	return w.sendAT(ctx, command, "")
+}
+
+// SendATData is SendAT for commands such as AT+CMGS that prompt with "> "
+// for a body. The body is sent after the prompt and terminated with Ctrl-Z.
+func (w *WebSocketClient) SendATData(ctx context.Context, command, data string) ([]string, error) {
+	if strings.ContainsAny(data, "\x1a\x1b") {
+		return nil, errors.New("data must not contain Ctrl-Z or ESC")
+	}
+	return w.sendAT(ctx, command, data)
+}
+
+func (w *WebSocketClient) sendAT(ctx context.Context, command, data string) ([]string, error) {
+	command = strings.TrimSpace(command)
+	if !strings.HasPrefix(strings.ToUpper(command), "AT") {
+		return nil, fmt.Errorf("not an AT command: %q", command)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.ATTimeout)
+		defer cancel()
+	}
+
+	// Serialize commands, but give up if our turn does not come in time
+	select {
+	case w.cmdSlot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ErrATTimeout
+	}
+
+	cmd := &atCommand{
+		command: command,
+		prefix:  responsePrefix(command),
+		done:    make(chan error, 1),
+	}
+	if data != "" {
+		cmd.prompt = make(chan struct{}, 1)
+	}
+
+	w.pendingMu.Lock()
+	w.pending = cmd
+	w.pendingMu.Unlock()
+
+	timedOut := false
+	defer func() {
+		if timedOut {
+			go w.drainCommand(cmd)
+			return
+		}
+		w.releaseCommand(cmd)
+	}()
+
+	start := time.Now()
+	if err := w.source.WriteFrame([]byte(command + "\r")); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", command, err)
+	}
+
+	if cmd.prompt != nil {
+		select {
+		case <-cmd.prompt:
+			if err := w.source.WriteFrame([]byte(data + "\x1a")); err != nil {
+				return nil, fmt.Errorf("failed to send %s data: %w", command, err)
+			}
+		case err := <-cmd.done:
+			// Rejected before the prompt
+			w.pendingMu.Lock()
+			lines := cmd.lines
+			w.pendingMu.Unlock()
+			return lines, err
+		case <-ctx.Done():
+			// Abort the input so the modem does not wait for the body
+			w.source.WriteFrame([]byte("\x1b"))
+			timedOut = true
+			return nil, ErrATTimeout
+		}
+	}
+
+	select {
+	case err := <-cmd.done:
+		w.pendingMu.Lock()
+		lines := cmd.lines
+		w.pendingMu.Unlock()
+		w.logger.Printf("DEBUG: %s completed in %v: %v", command, time.Since(start), err)
+		return lines, err
+	case <-ctx.Done():
+		timedOut = true
+		return nil, ErrATTimeout
+	}
+}
+
+// releaseCommand clears cmd as the pending command and frees the slot for
+// the next one
+func (w *WebSocketClient) releaseCommand(cmd *atCommand) {
+	w.pendingMu.Lock()
+	if w.pending == cmd {
+		w.pending = nil
+	}
+	w.pendingMu.Unlock()
+	<-w.cmdSlot
+}
+
+// drainCommand keeps a timed-out command pending until its final result
+// arrives, so that a late OK or ERROR is not taken as the result of the next
+// command. The modem is given up to another ATTimeout to answer.
+func (w *WebSocketClient) drainCommand(cmd *atCommand) {
+	timer := time.NewTimer(w.config.ATTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-cmd.done:
+		w.logger.Printf("DEBUG: Late result for %s discarded: %v", cmd.command, err)
+	case <-timer.C:
+		w.logger.Printf("WARN: No result for %s, releasing the command slot", cmd.command)
+	case <-w.shutdown:
+	}
+	w.releaseCommand(cmd)
+}
+
+// routeResponse feeds a received line to the pending command, if any
+func (w *WebSocketClient) routeResponse(line string) {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+
+	cmd := w.pending
+	if cmd == nil {
+		return
+	}
+
+	// Echo of the command itself when ATE1 is active
+	if strings.EqualFold(line, cmd.command) {
+		return
+	}
+
+	if line == "> " && cmd.prompt != nil {
+		select {
+		case cmd.prompt <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	if done, err := finalResult(line); done {
+		cmd.done <- err
+		w.pending = nil
+		return
+	}
+
+	if isUnsolicited(line) && (cmd.prefix == "" || !strings.HasPrefix(line, cmd.prefix)) {
+		return
+	}
+	cmd.lines = append(cmd.lines, line)
+}
+
+// failPending aborts the pending command, e.g. when the connection drops
+func (w *WebSocketClient) failPending(err error) {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+
+	if w.pending != nil {
+		w.pending.done <- err
+		w.pending = nil
+	}
+}
+
+// finalResult reports whether line terminates a command, and with what error
+func finalResult(line string) (bool, error) {
+	switch {
+	case line == "OK":
+		return true, nil
+	case line == "ERROR":
+		return true, ErrATError
+	case line == "COMMAND NOT SUPPORT":
+		return true, ErrATNotSupported
+	case strings.HasPrefix(line, "+CME ERROR:"):
+		code, text := parseErrorCode(strings.TrimPrefix(line, "+CME ERROR:"))
+		return true, &CMEError{Code: code, Text: text}
+	case strings.HasPrefix(line, "+CMS ERROR:"):
+		code, text := parseErrorCode(strings.TrimPrefix(line, "+CMS ERROR:"))
+		return true, &CMSError{Code: code, Text: text}
+	}
+	return false, nil
+}
+
+// parseErrorCode handles both numeric (CMEE=1) and verbose (CMEE=2) errors
+func parseErrorCode(value string) (int, string) {
+	value = strings.TrimSpace(value)
+	if code, err := strconv.Atoi(value); err == nil {
+		return code, ""
+	}
+	return -1, value
+}
+
+func isUnsolicited(line string) bool {
+	for _, prefix := range unsolicitedPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// responsePrefix derives the information response prefix of a command,
+// e.g. "AT^HCSQ?" yields "^HCSQ:" and "AT+CMGR=3" yields "+CMGR:"
+func responsePrefix(command string) string {
+	body := command[2:]
+	if body == "" || (body[0] != '+' && body[0] != '^') {
+		return ""
+	}
+	end := strings.IndexAny(body, "=?;")
+	if end < 0 {
+		end = len(body)
+	}
+	return strings.ToUpper(body[:end]) + ":"
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// scriptedSource is a ModemSource that answers every written command with
+// canned modem output
+type scriptedSource struct {
+	frames  chan []byte
+	written chan string
+	reply   func(command string) []string
+}
+
+func (s *scriptedSource) Connect(ctx context.Context) error { return nil }
+
+func (s *scriptedSource) ReadFrame() ([]byte, error) {
+	frame, ok := <-s.frames
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func (s *scriptedSource) WriteFrame(data []byte) error {
+	s.written <- string(data)
+	if s.reply != nil {
+		for _, frame := range s.reply(string(data)) {
+			s.frames <- []byte(frame)
+		}
+	}
+	return nil
+}
+
+func (s *scriptedSource) Close() error   { return nil }
+func (s *scriptedSource) String() string { return "scripted" }
+
+// newTestClient returns a client wired to a scriptedSource whose output is
+// fed to the client as it arrives
+func newTestClient(t *testing.T, reply func(command string) []string) (*WebSocketClient, *scriptedSource) {
+	t.Helper()
+	config := &Config{ATTimeout: 100 * time.Millisecond, RequestTimeout: time.Second}
+	client, err := NewWebSocketClient(config, &ModemStatus{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &scriptedSource{
+		frames:  make(chan []byte, 64),
+		written: make(chan string, 64),
+		reply:   reply,
+	}
+	client.source = source
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			frame, err := source.ReadFrame()
+			if err != nil {
+				return
+			}
+			client.handleMessage(frame)
+		}
+	}()
+	t.Cleanup(func() {
+		close(source.frames)
+		<-done
+	})
+	return client, source
+}
+
+func TestSendATLateResult(t *testing.T) {
+	client, source := newTestClient(t, func(command string) []string {
+		if command == "AT+CSQ\r" {
+			return []string{"+CSQ: 20,99\r\n", "OK\r\n"}
+		}
+		return nil
+	})
+
+	if _, err := client.SendAT(context.Background(), "AT+COPS=?"); err != ErrATTimeout {
+		t.Fatalf("SendAT(AT+COPS=?) error = %v, want ErrATTimeout", err)
+	}
+	<-source.written
+
+	type result struct {
+		lines []string
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		lines, err := client.SendAT(ctx, "AT+CSQ")
+		results <- result{lines, err}
+	}()
+
+	// The next command must wait until the late response is drained
+	select {
+	case command := <-source.written:
+		t.Fatalf("%q written before the timed-out command was drained", command)
+	case <-time.After(30 * time.Millisecond):
+	}
+	source.frames <- []byte("+COPS: (2,\"Operator\",\"Op\",\"26201\",7)\r\nOK\r\n")
+
+	r := <-results
+	if r.err != nil || len(r.lines) != 1 || r.lines[0] != "+CSQ: 20,99" {
+		t.Errorf("SendAT(AT+CSQ) = %q, %v, want the +CSQ line", r.lines, r.err)
+	}
+}
+
+func TestSendATDrainBounded(t *testing.T) {
+	client, _ := newTestClient(t, func(command string) []string {
+		if command == "AT+CSQ\r" {
+			return []string{"+CSQ: 20,99\r\n", "OK\r\n"}
+		}
+		return nil
+	})
+
+	if _, err := client.SendAT(context.Background(), "AT+COPS=?"); err != ErrATTimeout {
+		t.Fatalf("SendAT(AT+COPS=?) error = %v, want ErrATTimeout", err)
+	}
+
+	// No result ever arrives; the slot is released after another ATTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	lines, err := client.SendAT(ctx, "AT+CSQ")
+	if err != nil || len(lines) != 1 || lines[0] != "+CSQ: 20,99" {
+		t.Errorf("SendAT(AT+CSQ) = %q, %v, want the +CSQ line", lines, err)
+	}
+}
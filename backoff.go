@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Reconnect policies
+const (
+	// ReconnectForever keeps retrying for as long as the process runs
+	ReconnectForever = "forever"
+	// ReconnectExit stops the process with a non-zero status after
+	// MaxReconnect consecutive failures, leaving restarts to the supervisor
+	ReconnectExit = "exit"
+)
+
+// ReconnectState describes where the client is in its reconnect cycle
+type ReconnectState struct {
+	State         string     `json:"state"`
+	Attempt       int        `json:"attempt"`
+	NextRetry     *time.Time `json:"next_retry,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// Reconnect states
+const (
+	stateConnecting = "connecting"
+	stateConnected  = "connected"
+	stateWaiting    = "waiting"
+	stateFailed     = "failed"
+	stateStopped    = "stopped"
+)
+
+func validateReconnectPolicy(policy string) error {
+	switch policy {
+	case "", ReconnectForever, ReconnectExit:
+		return nil
+	default:
+		return fmt.Errorf("unknown reconnect policy %q", policy)
+	}
+}
+
+// backoffDelay returns the wait before the given attempt (1-based): the base
+// delay doubled per attempt, capped at max, with "equal jitter" so that a
+// fleet of monitors does not reconnect in lockstep
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	if max < base {
+		max = base
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// ReconnectState returns a snapshot of the reconnect state
+func (w *WebSocketClient) ReconnectState() ReconnectState {
+	w.reconnectMu.Lock()
+	defer w.reconnectMu.Unlock()
+	return w.reconnectState
+}
+
+func (w *WebSocketClient) setReconnectState(state string, next time.Time) {
+	w.reconnectMu.Lock()
+	defer w.reconnectMu.Unlock()
+
+	w.reconnectState.State = state
+	w.reconnectState.NextRetry = nil
+	if !next.IsZero() {
+		w.reconnectState.NextRetry = &next
+	}
+}
+
+func (w *WebSocketClient) recordReconnectError(err error) {
+	w.reconnectMu.Lock()
+	defer w.reconnectMu.Unlock()
+
+	now := time.Now()
+	w.reconnectState.LastError = err.Error()
+	w.reconnectState.LastErrorTime = &now
+}
+
+// nextAttempt bumps the attempt counter, first resetting it if the last
+// session stayed up for the cool-down period
+func (w *WebSocketClient) nextAttempt(sessionStart time.Time) int {
+	w.reconnectMu.Lock()
+	defer w.reconnectMu.Unlock()
+
+	if !sessionStart.IsZero() && time.Since(sessionStart) >= w.config.ReconnectCooldown {
+		w.reconnectState.Attempt = 0
+	}
+	w.reconnectState.Attempt++
+	return w.reconnectState.Attempt
+}
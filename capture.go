@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// captureRecord is one line of a capture file. A capture is a sequence of
+// sessions; each starts with a "session" record and T counts nanoseconds of
+// monotonic time since that record.
+type captureRecord struct {
+	Type    string     `json:"type"`
+	Time    *time.Time `json:"time,omitempty"`
+	Modem   string     `json:"modem"`
+	Source  string     `json:"source,omitempty"`
+	T       int64      `json:"t"`
+	Data    string     `json:"data,omitempty"`
+	DataB64 string     `json:"data_b64,omitempty"`
+}
+
+// captureFile is an append-only capture shared by all modems
+type captureFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openCapture opens path for appending; an empty path disables recording
+func openCapture(path string) (*captureFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %v", err)
+	}
+	return &captureFile{file: file}, nil
+}
+
+func (c *captureFile) write(rec captureRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+func (c *captureFile) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// frameRecorder records the frames of one modem into a captureFile. A nil
+// recorder records nothing.
+type frameRecorder struct {
+	capture *captureFile
+	modem   string
+	logger  *log.Logger
+
+	start time.Time
+}
+
+func newFrameRecorder(capture *captureFile, modem string, logger *log.Logger) *frameRecorder {
+	if capture == nil {
+		return nil
+	}
+	return &frameRecorder{
+		capture: capture,
+		modem:   modem,
+		logger:  logger,
+	}
+}
+
+// StartSession marks a new connection in the capture
+func (r *frameRecorder) StartSession(source ModemSource) {
+	if r == nil {
+		return
+	}
+	r.start = time.Now()
+	wall := r.start.Round(0)
+	r.save(captureRecord{
+		Type:   "session",
+		Time:   &wall,
+		Modem:  r.modem,
+		Source: source.String(),
+	})
+}
+
+// Frame records one received frame
+func (r *frameRecorder) Frame(data []byte) {
+	if r == nil {
+		return
+	}
+	rec := captureRecord{
+		Type:  "frame",
+		Modem: r.modem,
+		T:     int64(time.Since(r.start)),
+	}
+	if utf8.Valid(data) {
+		rec.Data = string(data)
+	} else {
+		rec.DataB64 = base64.StdEncoding.EncodeToString(data)
+	}
+	r.save(rec)
+}
+
+func (r *frameRecorder) save(rec captureRecord) {
+	if err := r.capture.write(rec); err != nil {
+		r.logger.Printf("WARN: Failed to write capture: %v", err)
+	}
+}
+
+// replaySource feeds a capture file back as if it came from the modem
+type replaySource struct {
+	config *Config
+	logger *log.Logger
+
+	mu      sync.Mutex // guards file, scanner, done, last, played and modem
+	file    *os.File
+	scanner *bufio.Scanner
+	done    chan struct{}
+	last    int64
+	played  bool // a frame was returned since the capture last started
+	modem   string
+}
+
+func newReplaySource(config *Config, logger *log.Logger) *replaySource {
+	return &replaySource{
+		config: config,
+		logger: logger,
+	}
+}
+
+func (s *replaySource) String() string {
+	if s.config.ReplayModem != "" {
+		return fmt.Sprintf("replay %s#%s x%g", s.config.ReplayFile, s.config.ReplayModem, s.config.ReplaySpeed)
+	}
+	return fmt.Sprintf("replay %s x%g", s.config.ReplayFile, s.config.ReplaySpeed)
+}
+
+func (s *replaySource) Connect(ctx context.Context) error {
+	file, err := os.Open(s.config.ReplayFile)
+	if err != nil {
+		return fmt.Errorf("failed to open capture: %v", err)
+	}
+
+	s.mu.Lock()
+	s.file = file
+	s.scanner = newCaptureScanner(file)
+	s.done = make(chan struct{})
+	s.last = 0
+	s.played = false
+	s.modem = s.config.ReplayModem
+	s.mu.Unlock()
+
+	return nil
+}
+
+func newCaptureScanner(file *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return scanner
+}
+
+// rewind starts the capture over from its first record. It reports false
+// when the last pass played nothing, so that looping would only spin.
+func (s *replaySource) rewind() (*bufio.Scanner, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil, false, errNotConnected
+	}
+	if !s.played {
+		return s.scanner, false, nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("failed to rewind capture: %v", err)
+	}
+	s.scanner = newCaptureScanner(s.file)
+	s.last = 0
+	s.played = false
+	return s.scanner, true, nil
+}
+
+// ReadFrame returns the next recorded frame, sleeping for the recorded gap
+// divided by ReplaySpeed. At the end of the capture it starts over when
+// ReplayLoop is set, without ending the session, and otherwise idles until
+// closed, leaving the final state on display.
+func (s *replaySource) ReadFrame() ([]byte, error) {
+	s.mu.Lock()
+	scanner, done := s.scanner, s.done
+	s.mu.Unlock()
+	if scanner == nil {
+		return nil, errNotConnected
+	}
+
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("capture read error: %v", err)
+			}
+			if s.config.ReplayLoop {
+				next, restarted, err := s.rewind()
+				if err != nil {
+					return nil, err
+				}
+				if restarted {
+					s.logger.Println("INFO: Replay finished, restarting")
+					scanner = next
+					continue
+				}
+			}
+			s.logger.Println("INFO: Replay finished")
+			<-done
+			return nil, errNotConnected
+		}
+
+		var rec captureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			s.logger.Printf("WARN: Skipping invalid capture line: %v", err)
+			continue
+		}
+
+		s.mu.Lock()
+		// Without an explicit modem, follow the first one in the capture
+		if s.modem == "" {
+			s.modem = rec.Modem
+		}
+		match := rec.Modem == s.modem
+		last := s.last
+		if match {
+			s.last = rec.T
+			s.played = s.played || rec.Type != "session"
+		}
+		s.mu.Unlock()
+
+		if !match {
+			continue
+		}
+		if rec.Type == "session" {
+			continue
+		}
+
+		if err := s.wait(time.Duration(rec.T-last), done); err != nil {
+			return nil, err
+		}
+
+		if rec.DataB64 != "" {
+			return base64.StdEncoding.DecodeString(rec.DataB64)
+		}
+		return []byte(rec.Data), nil
+	}
+}
+
+func (s *replaySource) wait(gap time.Duration, done chan struct{}) error {
+	if s.config.ReplaySpeed <= 0 || gap <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(float64(gap) / s.config.ReplaySpeed))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return errNotConnected
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WriteFrame is not supported: a capture cannot answer commands
+func (s *replaySource) WriteFrame(data []byte) error {
+	return fmt.Errorf("%s: %w", s, errReadOnlySource)
+}
+
+func (s *replaySource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.file.Close()
+	s.file = nil
+	s.scanner = nil
+	s.done = nil
+	return err
+}
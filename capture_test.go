@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCapture records frames for modem "a" into a new capture file
+func writeCapture(t *testing.T, frames ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := openCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := newFrameRecorder(capture, "a", log.New(io.Discard, "", 0))
+	recorder.StartSession(newReplaySource(&Config{}, nil))
+	for _, frame := range frames {
+		recorder.Frame([]byte(frame))
+	}
+	if err := capture.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayLoopRestartsWithinSession(t *testing.T) {
+	path := writeCapture(t, "^RSSI: 10\r\n", "^RSSI: 20\r\n")
+	source := newReplaySource(&Config{ReplayFile: path, ReplayLoop: true}, log.New(io.Discard, "", 0))
+	if err := source.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	for i, want := range []string{"^RSSI: 10\r\n", "^RSSI: 20\r\n", "^RSSI: 10\r\n", "^RSSI: 20\r\n", "^RSSI: 10\r\n"} {
+		frame, err := source.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if string(frame) != want {
+			t.Errorf("frame %d = %q, want %q", i, frame, want)
+		}
+	}
+}
+
+func TestReplayLoopIdlesOnEmptyCapture(t *testing.T) {
+	path := writeCapture(t)
+	source := newReplaySource(&Config{ReplayFile: path, ReplayLoop: true}, log.New(io.Discard, "", 0))
+	if err := source.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := source.ReadFrame()
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		t.Fatalf("ReadFrame() returned %v, want it to idle", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	source.Close()
+	if err := <-errs; err != errNotConnected {
+		t.Errorf("ReadFrame() after Close = %v, want errNotConnected", err)
+	}
+}
+
+func TestReplayWithoutLoopKeepsFinalState(t *testing.T) {
+	path := writeCapture(t, "^RSSI: 10\r\n")
+	source := newReplaySource(&Config{ReplayFile: path}, log.New(io.Discard, "", 0))
+	if err := source.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := source.ReadFrame(); err != nil || string(frame) != "^RSSI: 10\r\n" {
+		t.Fatalf("ReadFrame() = %q, %v", frame, err)
+	}
+	time.AfterFunc(20*time.Millisecond, func() { source.Close() })
+	if _, err := source.ReadFrame(); err != errNotConnected {
+		t.Errorf("ReadFrame() at the end = %v, want errNotConnected", err)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServingCell identifies the cell the modem is camped on
+type ServingCell struct {
+	RAT          string    `json:"rat,omitempty"`
+	Registration string    `json:"registration,omitempty"`
+	PLMN         string    `json:"plmn,omitempty"`
+	TAC          string    `json:"tac,omitempty"` // hex, LTE
+	LAC          string    `json:"lac,omitempty"` // hex, GSM/UMTS
+	CellID       string    `json:"cell_id,omitempty"`
+	ENodeB       *int64    `json:"enodeb_id,omitempty"`
+	Sector       *int64    `json:"sector,omitempty"`
+	RNC          *int64    `json:"rnc_id,omitempty"`
+	PCI          *int      `json:"pci,omitempty"`
+	Band         int       `json:"band,omitempty"`
+	DLChannel    *int      `json:"dl_earfcn,omitempty"`
+	ULChannel    *int      `json:"ul_earfcn,omitempty"`
+	DLFreqMHz    *float64  `json:"dl_freq_mhz,omitempty"`
+	ULFreqMHz    *float64  `json:"ul_freq_mhz,omitempty"`
+	DLBandwidth  *float64  `json:"dl_bandwidth_mhz,omitempty"`
+	ULBandwidth  *float64  `json:"ul_bandwidth_mhz,omitempty"`
+	LastUpdate   time.Time `json:"last_update"`
+	LastHandover time.Time `json:"last_handover,omitempty"`
+}
+
+// registrationStates names the <stat> of +CREG, +CGREG and +CEREG
+var registrationStates = map[int]string{
+	0: "not registered",
+	1: "registered, home",
+	2: "searching",
+	3: "registration denied",
+	4: "unknown",
+	5: "registered, roaming",
+}
+
+// registrationRATs names the <AcT> of the registration reports
+var registrationRATs = map[int]string{
+	0: "GSM", 1: "GSM", 2: "UMTS", 3: "GSM", 4: "UMTS", 5: "UMTS", 6: "UMTS", 7: "LTE",
+}
+
+// hfreqinfoRATs names the <sysmode> of ^HFREQINFO
+var hfreqinfoRATs = map[int]string{0: "NO SERVICE", 1: "GSM", 3: "WCDMA", 4: "TD-SCDMA", 6: "LTE"}
+
+// lteBand holds the 3GPP TS 36.101 channel raster of an E-UTRA band
+type lteBand struct {
+	Band     int
+	DLLow    float64 // MHz
+	DLOffset int
+	DLMax    int
+	ULLow    float64 // MHz, 0 for downlink-only bands
+	ULOffset int
+	ULMax    int // uplink may be narrower than the downlink (bands 66, 70)
+	TDD      bool
+}
+
+// lteBands is TS 36.101 Table 5.7.3-1
+var lteBands = []lteBand{
+	{1, 2110, 0, 599, 1920, 18000, 18599, false},
+	{2, 1930, 600, 1199, 1850, 18600, 19199, false},
+	{3, 1805, 1200, 1949, 1710, 19200, 19949, false},
+	{4, 2110, 1950, 2399, 1710, 19950, 20399, false},
+	{5, 869, 2400, 2649, 824, 20400, 20649, false},
+	{6, 875, 2650, 2749, 830, 20650, 20749, false},
+	{7, 2620, 2750, 3449, 2500, 20750, 21449, false},
+	{8, 925, 3450, 3799, 880, 21450, 21799, false},
+	{9, 1844.9, 3800, 4149, 1749.9, 21800, 22149, false},
+	{10, 2110, 4150, 4749, 1710, 22150, 22749, false},
+	{11, 1475.9, 4750, 4949, 1427.9, 22750, 22949, false},
+	{12, 729, 5010, 5179, 699, 23010, 23179, false},
+	{13, 746, 5180, 5279, 777, 23180, 23279, false},
+	{14, 758, 5280, 5379, 788, 23280, 23379, false},
+	{17, 734, 5730, 5849, 704, 23730, 23849, false},
+	{18, 860, 5850, 5999, 815, 23850, 23999, false},
+	{19, 875, 6000, 6149, 830, 24000, 24149, false},
+	{20, 791, 6150, 6449, 832, 24150, 24449, false},
+	{21, 1495.9, 6450, 6599, 1447.9, 24450, 24599, false},
+	{22, 3510, 6600, 7399, 3410, 24600, 25399, false},
+	{23, 2180, 7500, 7699, 2000, 25500, 25699, false},
+	{24, 1525, 7700, 8039, 1626.5, 25700, 26039, false},
+	{25, 1930, 8040, 8689, 1850, 26040, 26689, false},
+	{26, 859, 8690, 9039, 814, 26690, 27039, false},
+	{27, 852, 9040, 9209, 807, 27040, 27209, false},
+	{28, 758, 9210, 9659, 703, 27210, 27659, false},
+	{29, 717, 9660, 9769, 0, 0, 0, false},
+	{30, 2350, 9770, 9869, 2305, 27660, 27759, false},
+	{31, 462.5, 9870, 9919, 452.5, 27760, 27809, false},
+	{32, 1452, 9920, 10359, 0, 0, 0, false},
+	{33, 1900, 36000, 36199, 0, 0, 0, true},
+	{34, 2010, 36200, 36349, 0, 0, 0, true},
+	{35, 1850, 36350, 36949, 0, 0, 0, true},
+	{36, 1930, 36950, 37549, 0, 0, 0, true},
+	{37, 1910, 37550, 37749, 0, 0, 0, true},
+	{38, 2570, 37750, 38249, 0, 0, 0, true},
+	{39, 1880, 38250, 38649, 0, 0, 0, true},
+	{40, 2300, 38650, 39649, 0, 0, 0, true},
+	{41, 2496, 39650, 41589, 0, 0, 0, true},
+	{42, 3400, 41590, 43589, 0, 0, 0, true},
+	{43, 3600, 43590, 45589, 0, 0, 0, true},
+	{44, 703, 45590, 46589, 0, 0, 0, true},
+	{45, 1447, 46590, 46789, 0, 0, 0, true},
+	{46, 5150, 46790, 54539, 0, 0, 0, true},
+	{47, 5855, 54540, 55239, 0, 0, 0, true},
+	{48, 3550, 55240, 56739, 0, 0, 0, true},
+	{49, 3550, 56740, 58239, 0, 0, 0, true},
+	{50, 1432, 58240, 59089, 0, 0, 0, true},
+	{51, 1427, 59090, 59139, 0, 0, 0, true},
+	{52, 3300, 59140, 60139, 0, 0, 0, true},
+	{53, 2483.5, 60140, 60254, 0, 0, 0, true},
+	{65, 2110, 65536, 66435, 1920, 131072, 131971, false},
+	{66, 2110, 66436, 67335, 1710, 131972, 132671, false},
+	{67, 738, 67336, 67535, 0, 0, 0, false},
+	{68, 753, 67536, 67835, 698, 132672, 132971, false},
+	{69, 2570, 67836, 68335, 0, 0, 0, false},
+	{70, 1995, 68336, 68585, 1695, 132972, 133121, false},
+	{71, 617, 68586, 68935, 663, 133122, 133471, false},
+	{72, 461, 68936, 68985, 451, 133472, 133521, false},
+	{73, 460, 68986, 69035, 450, 133522, 133571, false},
+	{74, 1475, 69036, 69465, 1427, 133572, 134001, false},
+	{75, 1432, 69466, 70315, 0, 0, 0, false},
+	{76, 1427, 70316, 70365, 0, 0, 0, false},
+	{85, 728, 70366, 70545, 698, 134002, 134181, false},
+	{87, 420, 70546, 70595, 410, 134182, 134231, false},
+	{88, 422, 70596, 70645, 412, 134232, 134281, false},
+}
+
+// earfcnInfo resolves a downlink EARFCN to its band, the paired uplink
+// EARFCN and both centre frequencies. ok is false for unknown channels.
+func earfcnInfo(earfcn int) (band int, ulEARFCN int, dlMHz, ulMHz float64, ok bool) {
+	for _, b := range lteBands {
+		if earfcn < b.DLOffset || earfcn > b.DLMax {
+			continue
+		}
+		dlMHz = roundMHz(b.DLLow + 0.1*float64(earfcn-b.DLOffset))
+		switch {
+		case b.TDD:
+			return b.Band, earfcn, dlMHz, dlMHz, true
+		case b.ULLow == 0:
+			return b.Band, 0, dlMHz, 0, true
+		}
+		ulEARFCN = earfcn - b.DLOffset + b.ULOffset
+		if ulEARFCN > b.ULMax {
+			// Downlink-only part of an asymmetric band
+			return b.Band, 0, dlMHz, 0, true
+		}
+		ulMHz = roundMHz(b.ULLow + 0.1*float64(earfcn-b.DLOffset))
+		return b.Band, ulEARFCN, dlMHz, ulMHz, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+func roundMHz(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// splitATFields splits a response body on commas outside quotes and strips
+// the quotes
+func splitATFields(body string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for _, r := range body {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			fields = append(fields, strings.TrimSpace(field.String()))
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	return append(fields, strings.TrimSpace(field.String()))
+}
+
+func init() {
+	registerURCParser("+CREG:", parseRegistration)
+	registerURCParser("+CGREG:", parseRegistration)
+	registerURCParser("+CEREG:", parseRegistration)
+	registerURCParser("^CECELLID:", parseCECELLID)
+	registerURCParser("^HFREQINFO:", parseHFREQINFO)
+}
+
+// CellReport updates the serving cell. Only the set fields are changed.
+type CellReport struct {
+	Command      string
+	RAT          string
+	Registration string
+	PLMN         string
+	TAC          string
+	LAC          string
+	CellID       string
+	PCI          *int
+	Band         int
+	DLChannel    *int
+	ULChannel    *int
+	DLFreqMHz    *float64
+	ULFreqMHz    *float64
+	DLBandwidth  *float64
+	ULBandwidth  *float64
+}
+
+// parseRegistration decodes +CREG, +CGREG and +CEREG. The read response
+// starts with <n>, the unsolicited report does not:
+//
+//	+CEREG: [<n>,]<stat>[,[<tac>],[<ci>],[<AcT>]]
+func parseRegistration(line string) (urcResult, error) {
+	prefix, body, _ := strings.Cut(line, ":")
+	raw := strings.Split(strings.TrimSpace(body), ",")
+	fields := splitATFields(strings.TrimSpace(body))
+
+	// The location fields are quoted; a read response has them one later
+	start := 1
+	switch {
+	case len(raw) > 1 && strings.HasPrefix(strings.TrimSpace(raw[1]), `"`):
+		start = 0
+	case len(raw) > 2 && strings.HasPrefix(strings.TrimSpace(raw[2]), `"`):
+	case len(raw) == 1:
+		start = 0
+	}
+	if start >= len(fields) {
+		return nil, fmt.Errorf("malformed %s: %q", prefix, line)
+	}
+
+	stat, err := strconv.Atoi(fields[start])
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s: %q", prefix, line)
+	}
+	r := CellReport{Command: prefix, Registration: codeName(registrationStates, strconv.Itoa(stat))}
+	loc := fields[start+1:]
+	if len(loc) >= 2 && loc[0] != "" && loc[1] != "" {
+		if prefix == "+CEREG" {
+			r.TAC = strings.ToUpper(loc[0])
+		} else {
+			r.LAC = strings.ToUpper(loc[0])
+		}
+		r.CellID = strings.ToUpper(loc[1])
+	}
+	if len(loc) >= 3 && loc[2] != "" {
+		r.RAT = codeName(registrationRATs, loc[2])
+	} else if prefix == "+CEREG" && r.CellID != "" {
+		r.RAT = "LTE"
+	}
+	return r, nil
+}
+
+// parseCECELLID decodes ^CECELLID: <plmn>,<ci>,<pci>,<tac>
+func parseCECELLID(line string) (urcResult, error) {
+	_, body, _ := strings.Cut(line, ":")
+	fields := splitATFields(strings.TrimSpace(body))
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("malformed ^CECELLID: %q", line)
+	}
+	pci, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ^CECELLID: %q", line)
+	}
+	return CellReport{
+		Command: "^CECELLID",
+		RAT:     "LTE",
+		PLMN:    fields[0],
+		CellID:  strings.ToUpper(fields[1]),
+		PCI:     &pci,
+		TAC:     strings.ToUpper(fields[3]),
+	}, nil
+}
+
+// parseHFREQINFO decodes the primary carrier of ^HFREQINFO: [<n>,]<sysmode>,
+// <band_class>,<dl_fcn>,<dl_freq>,<dl_bw>,<ul_fcn>,<ul_freq>,<ul_bw>,...
+// Frequencies are in 100 kHz and bandwidths in kHz.
+func parseHFREQINFO(line string) (urcResult, error) {
+	_, body, _ := strings.Cut(line, ":")
+	fields := splitATFields(strings.TrimSpace(body))
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("malformed ^HFREQINFO: %q", line)
+		}
+		values[i] = v
+	}
+
+	// Each carrier has 7 values after the sysmode
+	switch {
+	case len(values) >= 9 && (len(values)-2)%7 == 0:
+		values = values[1:]
+	case len(values) >= 8 && (len(values)-1)%7 == 0:
+	case len(values) <= 2:
+		// No service: only [<n>,]<sysmode>
+		return CellReport{Command: "^HFREQINFO"}, nil
+	default:
+		return nil, fmt.Errorf("malformed ^HFREQINFO: %q", line)
+	}
+
+	mhz := func(v int, unit float64) *float64 {
+		f := roundMHz(float64(v) * unit)
+		return &f
+	}
+	dlChannel, ulChannel := values[2], values[5]
+	return CellReport{
+		Command:     "^HFREQINFO",
+		RAT:         codeName(hfreqinfoRATs, strconv.Itoa(values[0])),
+		Band:        values[1],
+		DLChannel:   &dlChannel,
+		DLFreqMHz:   mhz(values[3], 0.1),
+		DLBandwidth: mhz(values[4], 0.001),
+		ULChannel:   &ulChannel,
+		ULFreqMHz:   mhz(values[6], 0.1),
+		ULBandwidth: mhz(values[7], 0.001),
+	}, nil
+}
+
+func (r CellReport) apply(w *WebSocketClient) {
+	w.modemStatus.mu.Lock()
+	cell := &w.modemStatus.Cell
+	prev := *cell
+
+	if r.RAT != "" {
+		cell.RAT = r.RAT
+	}
+	if r.Registration != "" {
+		cell.Registration = r.Registration
+	}
+	if r.PLMN != "" {
+		cell.PLMN = r.PLMN
+	}
+	if r.TAC != "" {
+		cell.TAC, cell.LAC = r.TAC, ""
+	}
+	if r.LAC != "" {
+		cell.LAC, cell.TAC = r.LAC, ""
+	}
+	if r.CellID != "" {
+		cell.CellID = r.CellID
+		cell.ENodeB, cell.Sector, cell.RNC = nil, nil, nil
+		if ci, err := strconv.ParseInt(r.CellID, 16, 64); err == nil {
+			if cell.RAT == "LTE" {
+				// 28-bit E-UTRAN cell identity: 20-bit eNB ID, 8-bit cell
+				enb, sector := ci>>8, ci&0xff
+				cell.ENodeB, cell.Sector = &enb, &sector
+			} else if cell.RAT == "UMTS" || cell.RAT == "WCDMA" {
+				// 28-bit UTRAN cell identity: 12-bit RNC ID, 16-bit cell
+				rnc := ci >> 16
+				cell.RNC = &rnc
+			}
+		}
+		if prev.CellID != r.CellID {
+			// A new cell invalidates what we knew about the old one
+			cell.PCI = nil
+		}
+	}
+	if r.PCI != nil {
+		cell.PCI = r.PCI
+	}
+	if r.DLChannel != nil {
+		cell.Band = r.Band
+		cell.DLChannel, cell.ULChannel = r.DLChannel, r.ULChannel
+		cell.DLFreqMHz, cell.ULFreqMHz = r.DLFreqMHz, r.ULFreqMHz
+		cell.DLBandwidth, cell.ULBandwidth = r.DLBandwidth, r.ULBandwidth
+
+		// Fill in what the modem left out from the channel raster
+		if band, ul, dl, ulf, ok := earfcnInfo(*r.DLChannel); ok && cell.RAT == "LTE" {
+			if cell.Band == 0 {
+				cell.Band = band
+			}
+			if cell.DLFreqMHz == nil || *cell.DLFreqMHz == 0 {
+				cell.DLFreqMHz = &dl
+			}
+			if cell.ULChannel == nil || *cell.ULChannel == 0 {
+				cell.ULChannel = &ul
+			}
+			if cell.ULFreqMHz == nil || *cell.ULFreqMHz == 0 {
+				cell.ULFreqMHz = &ulf
+			}
+		}
+	}
+
+	handover := prev.CellID != "" && cell.CellID != prev.CellID
+	if handover {
+		cell.LastHandover = time.Now()
+	}
+	cell.LastUpdate = time.Now()
+	current := *cell
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+
+	if r.Command == "^HFREQINFO" {
+		w.markRefreshed("hfreqinfo")
+	} else if r.Command == "+CEREG" || r.Command == "+CREG" {
+		w.markRefreshed("cereg")
+	}
+
+	if handover {
+		w.recordEvent(eventHandover, fmt.Sprintf("Cell changed from %s to %s", prev.describe(), current.describe()),
+			map[string]string{
+				"from_cell": prev.CellID,
+				"to_cell":   current.CellID,
+				"from_area": prev.TAC + prev.LAC,
+				"to_area":   current.TAC + current.LAC,
+				"rat":       current.RAT,
+			})
+	}
+}
+
+// describe names a cell for logs and events
+func (c ServingCell) describe() string {
+	s := c.CellID
+	if c.ENodeB != nil {
+		s = fmt.Sprintf("%s (eNB %d sector %d)", c.CellID, *c.ENodeB, *c.Sector)
+	}
+	if c.TAC != "" {
+		s += " TAC " + c.TAC
+	} else if c.LAC != "" {
+		s += " LAC " + c.LAC
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestEARFCNInfo(t *testing.T) {
+	tests := []struct {
+		earfcn int
+		band   int
+		ul     int
+		dlMHz  float64
+		ulMHz  float64
+		ok     bool
+	}{
+		{1300, 3, 19300, 1815, 1720, true},
+		{6300, 20, 24300, 806, 847, true},
+		{3900, 9, 21900, 1854.9, 1759.9, true},
+		{5900, 18, 23900, 865, 820, true},
+		{6100, 19, 24100, 885, 840, true},
+		{6525, 21, 24525, 1503.4, 1455.4, true},
+		{9700, 29, 0, 721, 0, true},
+		{36275, 34, 36275, 2017.5, 2017.5, true},
+		{38400, 39, 38400, 1895, 1895, true},
+		{66500, 66, 132036, 2116.4, 1716.4, true},
+		{67200, 66, 0, 2186.4, 0, true}, // downlink-only part of band 66
+		{70000, 75, 0, 1485.4, 0, true},
+		{5000, 0, 0, 0, 0, false},
+		{-1, 0, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		band, ul, dlMHz, ulMHz, ok := earfcnInfo(tt.earfcn)
+		if band != tt.band || ul != tt.ul || dlMHz != tt.dlMHz || ulMHz != tt.ulMHz || ok != tt.ok {
+			t.Errorf("earfcnInfo(%d) = band %d, UL %d, %v/%v MHz, %t; want band %d, UL %d, %v/%v MHz, %t",
+				tt.earfcn, band, ul, dlMHz, ulMHz, ok, tt.band, tt.ul, tt.dlMHz, tt.ulMHz, tt.ok)
+		}
+	}
+}
+
+func TestLTEBandsConsistent(t *testing.T) {
+	for i, b := range lteBands {
+		if b.DLMax < b.DLOffset {
+			t.Errorf("band %d: downlink range %d-%d", b.Band, b.DLOffset, b.DLMax)
+		}
+		if i > 0 && b.DLOffset <= lteBands[i-1].DLMax {
+			t.Errorf("band %d overlaps band %d", b.Band, lteBands[i-1].Band)
+		}
+		if b.ULLow != 0 && (b.ULMax < b.ULOffset || b.ULMax-b.ULOffset > b.DLMax-b.DLOffset) {
+			t.Errorf("band %d: uplink range %d-%d", b.Band, b.ULOffset, b.ULMax)
+		}
+	}
+}
+
+func TestParseRegistration(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    CellReport
+		wantErr bool
+	}{
+		{
+			line: `+CEREG: 2,1,"1A2B","01A2B3C4",7`,
+			want: CellReport{Command: "+CEREG", Registration: "registered, home", TAC: "1A2B", CellID: "01A2B3C4", RAT: "LTE"},
+		},
+		{
+			line: `+CEREG: 5,"1a2b","01a2b3c4",7`,
+			want: CellReport{Command: "+CEREG", Registration: "registered, roaming", TAC: "1A2B", CellID: "01A2B3C4", RAT: "LTE"},
+		},
+		{
+			line: `+CEREG: 1,"1A2B","01A2B3C4"`,
+			want: CellReport{Command: "+CEREG", Registration: "registered, home", TAC: "1A2B", CellID: "01A2B3C4", RAT: "LTE"},
+		},
+		{line: `+CEREG: 2,1`, want: CellReport{Command: "+CEREG", Registration: "registered, home"}},
+		{line: `+CEREG: 2`, want: CellReport{Command: "+CEREG", Registration: "searching"}},
+		{
+			line: `+CGREG: 2,1,"00A1","0123ABCD",2`,
+			want: CellReport{Command: "+CGREG", Registration: "registered, home", LAC: "00A1", CellID: "0123ABCD", RAT: "UMTS"},
+		},
+		{
+			line: `+CREG: 0,"00A1","1F2E",0`,
+			want: CellReport{Command: "+CREG", Registration: "not registered", LAC: "00A1", CellID: "1F2E", RAT: "GSM"},
+		},
+		{line: `+CEREG:`, wantErr: true},
+		{line: `+CEREG: x,"1A2B","01A2B3C4",7`, wantErr: true},
+		{line: `+CEREG: 2,x`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRegistration(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRegistration(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRegistration(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRegistration(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseCECELLID(t *testing.T) {
+	pci := 123
+	got, err := parseCECELLID(`^CECELLID: "26201","01a2b3c4",123,"1a2b"`)
+	want := CellReport{Command: "^CECELLID", RAT: "LTE", PLMN: "26201", CellID: "01A2B3C4", PCI: &pci, TAC: "1A2B"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCECELLID() = %+v, %v, want %+v", got, err, want)
+	}
+	for _, line := range []string{`^CECELLID: "26201","01A2B3C4",123`, `^CECELLID: "26201","01A2B3C4",x,"1A2B"`, `^CECELLID:`} {
+		if got, err := parseCECELLID(line); err == nil {
+			t.Errorf("parseCECELLID(%q) = %+v, want an error", line, got)
+		}
+	}
+}
+
+func TestParseHFREQINFO(t *testing.T) {
+	num := func(v int) *int { return &v }
+	mhz := func(v float64) *float64 { return &v }
+	lte := CellReport{
+		Command: "^HFREQINFO", RAT: "LTE", Band: 3,
+		DLChannel: num(1300), DLFreqMHz: mhz(1815), DLBandwidth: mhz(20),
+		ULChannel: num(19300), ULFreqMHz: mhz(1720), ULBandwidth: mhz(20),
+	}
+
+	tests := []struct {
+		line    string
+		want    CellReport
+		wantErr bool
+	}{
+		{line: `^HFREQINFO: 1,6,3,1300,18150,20000,19300,17200,20000`, want: lte},
+		{line: `^HFREQINFO:6,3,1300,18150,20000,19300,17200,20000`, want: lte},
+		{
+			// A second carrier is ignored
+			line: `^HFREQINFO: 1,6,3,1300,18150,20000,19300,17200,20000,20,6300,8060,10000,24300,8470,10000`,
+			want: lte,
+		},
+		{line: `^HFREQINFO: 1,0`, want: CellReport{Command: "^HFREQINFO"}},
+		{line: `^HFREQINFO: 0`, want: CellReport{Command: "^HFREQINFO"}},
+		{line: `^HFREQINFO: 1,6,3,1300`, wantErr: true},
+		{line: `^HFREQINFO: 1,6,3,1300,18150,20000,19300,17200,x`, wantErr: true},
+		{line: `^HFREQINFO:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHFREQINFO(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHFREQINFO(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHFREQINFO(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHFREQINFO(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestServingCellIdentity(t *testing.T) {
+	client, err := NewWebSocketClient(&Config{}, &ModemStatus{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 28-bit ECI: 20-bit eNB ID and 8-bit sector
+	client.handleLine(`+CEREG: 2,1,"1A2B","01A2B3C4",7`)
+	cell := client.modemStatus.Cell
+	if cell.ENodeB == nil || *cell.ENodeB != 0x1A2B3 || cell.Sector == nil || *cell.Sector != 0xC4 || cell.RNC != nil {
+		t.Errorf("LTE cell %s: eNB/sector not split", cell.describe())
+	}
+
+	// The band and uplink come from the raster when the modem reports 0
+	client.handleLine(`^HFREQINFO: 1,6,0,6300,8060,10000,0,0,10000`)
+	cell = client.modemStatus.Cell
+	if cell.Band != 20 || cell.ULChannel == nil || *cell.ULChannel != 24300 || cell.ULFreqMHz == nil || *cell.ULFreqMHz != 847 {
+		t.Errorf("band %d, UL %v, want band 20, UL 24300 at 847 MHz", cell.Band, cell.ULChannel)
+	}
+
+	// 28-bit UTRAN cell identity: 12-bit RNC ID
+	client.handleLine(`+CGREG: 2,1,"00A1","0123ABCD",2`)
+	cell = client.modemStatus.Cell
+	if cell.RNC == nil || *cell.RNC != 0x123 || cell.ENodeB != nil || cell.TAC != "" || cell.LAC != "00A1" {
+		t.Errorf("UMTS cell %s: RNC not split", cell.describe())
+	}
+	if events := client.events.list(); len(events) != 1 || events[0].Type != eventHandover {
+		t.Errorf("events = %+v, want one handover", events)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cells not heard for cellSurveyTTL are dropped from the survey
+const cellSurveyTTL = 24 * time.Hour
+
+// SurveyCell is a cell seen by ^MONSC or ^MONNC. PCI holds the LTE physical
+// cell ID, the WCDMA primary scrambling code or the GSM BSIC.
+type SurveyCell struct {
+	RAT       string    `json:"rat"`
+	ARFCN     int       `json:"earfcn"`
+	PCI       int       `json:"pci"`
+	Band      int       `json:"band,omitempty"`
+	DLFreqMHz *float64  `json:"dl_freq_mhz,omitempty"`
+	CellID    string    `json:"cell_id,omitempty"`
+	Serving   bool      `json:"serving"`
+	RSRP      *float64  `json:"rsrp,omitempty"`
+	RSRQ      *float64  `json:"rsrq,omitempty"`
+	RSCP      *float64  `json:"rscp,omitempty"`
+	ECIO      *float64  `json:"ecio,omitempty"`
+	RxLev     *float64  `json:"rxlev,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Reports   int64     `json:"reports"`
+}
+
+func (c *SurveyCell) key() string {
+	return fmt.Sprintf("%s/%d/%d", c.RAT, c.ARFCN, c.PCI)
+}
+
+// cellSurvey accumulates the cells a modem has heard
+type cellSurvey struct {
+	mu    sync.Mutex
+	cells map[string]*SurveyCell
+}
+
+// update merges a measurement into the survey
+func (s *cellSurvey) update(m SurveyCell) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cells == nil {
+		s.cells = make(map[string]*SurveyCell)
+	}
+	now := time.Now()
+	for key, cell := range s.cells {
+		if now.Sub(cell.LastSeen) > cellSurveyTTL {
+			delete(s.cells, key)
+		} else if m.Serving {
+			// Only one serving cell at a time
+			cell.Serving = false
+		}
+	}
+
+	cell, ok := s.cells[m.key()]
+	if !ok {
+		m.FirstSeen = now
+		cell = &m
+		s.cells[m.key()] = cell
+	} else {
+		firstSeen, reports, cellID := cell.FirstSeen, cell.Reports, cell.CellID
+		*cell = m
+		cell.FirstSeen, cell.Reports = firstSeen, reports
+		if cell.CellID == "" {
+			cell.CellID = cellID
+		}
+	}
+	cell.LastSeen = now
+	cell.Reports++
+}
+
+// list returns the cells, serving cell first, then strongest first
+func (s *cellSurvey) list() []SurveyCell {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cells := make([]SurveyCell, 0, len(s.cells))
+	for _, cell := range s.cells {
+		cells = append(cells, *cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Serving != cells[j].Serving {
+			return cells[i].Serving
+		}
+		return cells[i].strength() > cells[j].strength()
+	})
+	return cells
+}
+
+// strength orders cells of any RAT by received level
+func (c SurveyCell) strength() float64 {
+	for _, v := range []*float64{c.RSRP, c.RSCP, c.RxLev} {
+		if v != nil {
+			return *v
+		}
+	}
+	return -1000
+}
+
+func init() {
+	registerURCParser("^MONSC:", parseMONSC)
+	registerURCParser("^MONNC:", parseMONNC)
+}
+
+// optionalLevel parses a measurement, nil when empty or not a number
+func optionalLevel(field string) *float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// CellSurveyReport is one cell of a ^MONSC or ^MONNC response
+type CellSurveyReport struct {
+	Cell    SurveyCell
+	Serving *CellReport // identity of the serving cell, from ^MONSC
+}
+
+// parseMONSC decodes the serving cell:
+//
+//	^MONSC: LTE,<mcc>,<mnc>,<earfcn>,<cell_id>,<pci>,<tac>,<rsrp>,<rsrq>,<rxlev>
+//	^MONSC: WCDMA,<mcc>,<mnc>,<uarfcn>,<psc>,<cell_id>,<lac>,<rscp>,<rxlev>,<ecn0>[,...]
+//	^MONSC: GSM,<mcc>,<mnc>,<band>,<arfcn>,<bsic>,<cell_id>,<lac>,<rxlev>[,...]
+func parseMONSC(line string) (urcResult, error) {
+	_, body, _ := strings.Cut(line, ":")
+	f := splitATFields(strings.TrimSpace(body))
+	bad := fmt.Errorf("malformed ^MONSC: %q", line)
+	if len(f) == 0 || f[0] == "" {
+		return nil, bad
+	}
+
+	cell := SurveyCell{RAT: f[0], Serving: true}
+	serving := &CellReport{Command: "^MONSC"}
+	var err error
+	switch f[0] {
+	case "NONE":
+		return ignoredResult{}, nil
+	case "LTE":
+		if len(f) < 10 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[3]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[5]); err != nil {
+			return nil, bad
+		}
+		cell.CellID = strings.ToUpper(f[4])
+		cell.RSRP, cell.RSRQ, cell.RxLev = optionalLevel(f[7]), optionalLevel(f[8]), optionalLevel(f[9])
+		pci := cell.PCI
+		serving.RAT, serving.CellID, serving.PCI, serving.TAC = "LTE", cell.CellID, &pci, strings.ToUpper(f[6])
+	case "WCDMA":
+		if len(f) < 10 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[3]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[4]); err != nil {
+			return nil, bad
+		}
+		cell.CellID = strings.ToUpper(f[5])
+		cell.RSCP, cell.RxLev, cell.ECIO = optionalLevel(f[7]), optionalLevel(f[8]), optionalLevel(f[9])
+		serving.RAT, serving.CellID, serving.LAC = "WCDMA", cell.CellID, strings.ToUpper(f[6])
+	case "GSM":
+		if len(f) < 9 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[4]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[5]); err != nil {
+			return nil, bad
+		}
+		cell.CellID = strings.ToUpper(f[6])
+		cell.RxLev = optionalLevel(f[8])
+		serving.RAT, serving.CellID, serving.LAC = "GSM", cell.CellID, strings.ToUpper(f[7])
+	default:
+		return nil, bad
+	}
+	if f[1] != "" && len(f[1]) == 3 {
+		serving.PLMN = f[1] + f[2]
+	}
+	return CellSurveyReport{Cell: cell, Serving: serving}, nil
+}
+
+// parseMONNC decodes one neighbour cell:
+//
+//	^MONNC: LTE,<earfcn>,<pci>,<rsrp>,<rsrq>,<rxlev>
+//	^MONNC: WCDMA,<uarfcn>,<psc>,<rscp>,<ecn0>
+//	^MONNC: GSM,<band>,<arfcn>,<bsic>,<cell_id>,<lac>,<rxlev>
+func parseMONNC(line string) (urcResult, error) {
+	_, body, _ := strings.Cut(line, ":")
+	f := splitATFields(strings.TrimSpace(body))
+	bad := fmt.Errorf("malformed ^MONNC: %q", line)
+	if len(f) == 0 || f[0] == "" {
+		return nil, bad
+	}
+
+	cell := SurveyCell{RAT: f[0]}
+	var err error
+	switch f[0] {
+	case "NONE":
+		return ignoredResult{}, nil
+	case "LTE":
+		if len(f) < 5 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[1]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[2]); err != nil {
+			return nil, bad
+		}
+		cell.RSRP, cell.RSRQ = optionalLevel(f[3]), optionalLevel(f[4])
+		if len(f) > 5 {
+			cell.RxLev = optionalLevel(f[5])
+		}
+	case "WCDMA":
+		if len(f) < 5 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[1]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[2]); err != nil {
+			return nil, bad
+		}
+		cell.RSCP, cell.ECIO = optionalLevel(f[3]), optionalLevel(f[4])
+	case "GSM":
+		if len(f) < 7 {
+			return nil, bad
+		}
+		if cell.ARFCN, err = strconv.Atoi(f[2]); err != nil {
+			return nil, bad
+		}
+		if cell.PCI, err = strconv.Atoi(f[3]); err != nil {
+			return nil, bad
+		}
+		cell.CellID = strings.ToUpper(f[4])
+		cell.RxLev = optionalLevel(f[6])
+	default:
+		return nil, bad
+	}
+	return CellSurveyReport{Cell: cell}, nil
+}
+
+func (r CellSurveyReport) apply(w *WebSocketClient) {
+	cell := r.Cell
+	if cell.RAT == "LTE" {
+		if band, _, dl, _, ok := earfcnInfo(cell.ARFCN); ok {
+			cell.Band, cell.DLFreqMHz = band, &dl
+		}
+	}
+	w.cells.update(cell)
+
+	if r.Serving != nil {
+		r.Serving.apply(w)
+		w.markRefreshed("monsc")
+	} else {
+		w.markRefreshed("monnc")
+	}
+}
+
+// Cells returns the neighbour cell survey
+func (w *WebSocketClient) Cells() []SurveyCell {
+	return w.cells.list()
+}
+
+func (s *Server) handleCellsAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Client.Cells())
+}
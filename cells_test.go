@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestParseMONSC(t *testing.T) {
+	level := func(v float64) *float64 { return &v }
+	pci := 123
+
+	tests := []struct {
+		line    string
+		want    urcResult
+		wantErr bool
+	}{
+		{
+			line: `^MONSC: LTE,262,01,1300,01a2b3c4,123,1a2b,-95,-10,-65`,
+			want: CellSurveyReport{
+				Cell: SurveyCell{RAT: "LTE", ARFCN: 1300, PCI: 123, CellID: "01A2B3C4", Serving: true,
+					RSRP: level(-95), RSRQ: level(-10), RxLev: level(-65)},
+				Serving: &CellReport{Command: "^MONSC", RAT: "LTE", PLMN: "26201", CellID: "01A2B3C4", PCI: &pci, TAC: "1A2B"},
+			},
+		},
+		{
+			line: `^MONSC: WCDMA,250,01,10700,123,0123ABCD,00A1,-85,-70,-5,0`,
+			want: CellSurveyReport{
+				Cell: SurveyCell{RAT: "WCDMA", ARFCN: 10700, PCI: 123, CellID: "0123ABCD", Serving: true,
+					RSCP: level(-85), RxLev: level(-70), ECIO: level(-5)},
+				Serving: &CellReport{Command: "^MONSC", RAT: "WCDMA", PLMN: "25001", CellID: "0123ABCD", LAC: "00A1"},
+			},
+		},
+		{
+			line: `^MONSC: GSM,250,01,1,50,63,1F2E,00A1,-70`,
+			want: CellSurveyReport{
+				Cell:    SurveyCell{RAT: "GSM", ARFCN: 50, PCI: 63, CellID: "1F2E", Serving: true, RxLev: level(-70)},
+				Serving: &CellReport{Command: "^MONSC", RAT: "GSM", PLMN: "25001", CellID: "1F2E", LAC: "00A1"},
+			},
+		},
+		{
+			// Levels the modem leaves out stay unknown
+			line: `^MONSC: LTE,,,1300,01A2B3C4,123,1A2B,,,`,
+			want: CellSurveyReport{
+				Cell:    SurveyCell{RAT: "LTE", ARFCN: 1300, PCI: 123, CellID: "01A2B3C4", Serving: true},
+				Serving: &CellReport{Command: "^MONSC", RAT: "LTE", CellID: "01A2B3C4", PCI: &pci, TAC: "1A2B"},
+			},
+		},
+		{line: `^MONSC: NONE`, want: ignoredResult{}},
+		{line: `^MONSC: LTE,262,01,1300,01A2B3C4,123`, wantErr: true},
+		{line: `^MONSC: LTE,262,01,1300,01A2B3C4,x,1A2B,-95,-10,-65`, wantErr: true},
+		{line: `^MONSC: WCDMA,250,01`, wantErr: true},
+		{line: `^MONSC: GSM,250,01,1,x,63,1F2E,00A1,-70`, wantErr: true},
+		{line: `^MONSC: CDMA,1,2,3`, wantErr: true},
+		{line: `^MONSC:`, wantErr: true},
+		{line: `^MONSC`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMONSC(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseMONSC(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseMONSC(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMONSC(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseMONNC(t *testing.T) {
+	level := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		line    string
+		want    urcResult
+		wantErr bool
+	}{
+		{
+			line: `^MONNC: LTE,1300,124,-105,-12,-75`,
+			want: CellSurveyReport{Cell: SurveyCell{RAT: "LTE", ARFCN: 1300, PCI: 124, RSRP: level(-105), RSRQ: level(-12), RxLev: level(-75)}},
+		},
+		{
+			line: `^MONNC: LTE,6300,7,-110,-15`,
+			want: CellSurveyReport{Cell: SurveyCell{RAT: "LTE", ARFCN: 6300, PCI: 7, RSRP: level(-110), RSRQ: level(-15)}},
+		},
+		{
+			line: `^MONNC: WCDMA,10700,200,-95,-8`,
+			want: CellSurveyReport{Cell: SurveyCell{RAT: "WCDMA", ARFCN: 10700, PCI: 200, RSCP: level(-95), ECIO: level(-8)}},
+		},
+		{
+			line: `^MONNC: GSM,1,60,12,2a3b,00A1,-80`,
+			want: CellSurveyReport{Cell: SurveyCell{RAT: "GSM", ARFCN: 60, PCI: 12, CellID: "2A3B", RxLev: level(-80)}},
+		},
+		{line: `^MONNC: NONE`, want: ignoredResult{}},
+		{line: `^MONNC: LTE,1300,124`, wantErr: true},
+		{line: `^MONNC: LTE,x,124,-105,-12`, wantErr: true},
+		{line: `^MONNC: WCDMA,10700,x,-95,-8`, wantErr: true},
+		{line: `^MONNC: GSM,1,60,12`, wantErr: true},
+		{line: `^MONNC: UMB,1,2,3,4`, wantErr: true},
+		{line: `^MONNC:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMONNC(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseMONNC(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseMONNC(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMONNC(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCellSurvey(t *testing.T) {
+	client, err := NewWebSocketClient(&Config{}, &ModemStatus{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`^MONSC: LTE,262,01,1300,01A2B3C4,123,1A2B,-95,-10,-65`,
+		`^MONNC: LTE,1300,124,-105,-12,-75`,
+		`^MONNC: LTE,6300,7,-90,-9,-60`,
+		`^MONNC: LTE,1300,124,-100,-11,-70`,
+	} {
+		client.handleLine(line)
+	}
+
+	cells := client.Cells()
+	var got []string
+	for _, cell := range cells {
+		got = append(got, cell.key())
+	}
+	want := []string{"LTE/1300/123", "LTE/6300/7", "LTE/1300/124"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("survey = %q, want %q", got, want)
+	}
+	if !cells[0].Serving || cells[0].Band != 3 || cells[1].Band != 20 {
+		t.Errorf("serving %t, bands %d/%d, want serving band 3 and band 20", cells[0].Serving, cells[0].Band, cells[1].Band)
+	}
+	if cells[2].Reports != 2 || *cells[2].RSRP != -100 {
+		t.Errorf("cell %s: %d reports at %v dBm, want 2 at -100 dBm", cells[2].key(), cells[2].Reports, *cells[2].RSRP)
+	}
+	if cell := client.modemStatus.Cell; cell.PCI == nil || *cell.PCI != 123 || cell.PLMN != "26201" {
+		t.Errorf("serving cell not updated from ^MONSC: %+v", cell)
+	}
+
+	// A new serving cell takes over the flag
+	client.handleLine(`^MONSC: LTE,262,01,6300,01A2B307,7,1A2B,-90,-9,-60`)
+	for _, cell := range client.Cells() {
+		if cell.Serving != (cell.key() == "LTE/6300/7") {
+			t.Errorf("cell %s serving = %t", cell.key(), cell.Serving)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ndisStates names the ^NDISSTAT <stat>
+var ndisStates = map[int]string{
+	0: "disconnected",
+	1: "connected",
+	2: "connecting",
+	3: "disconnecting",
+}
+
+// smCauses names common 3GPP TS 24.008 session management causes, as
+// reported by ^NDISSTAT
+var smCauses = map[int]string{
+	8:  "operator determined barring",
+	25: "LLC or SNDCP failure",
+	26: "insufficient resources",
+	27: "missing or unknown APN",
+	28: "unknown PDP address or type",
+	29: "user authentication failed",
+	30: "activation rejected by GGSN",
+	31: "activation rejected, unspecified",
+	32: "service option not supported",
+	33: "service option not subscribed",
+	34: "service option temporarily out of order",
+	36: "regular deactivation",
+	38: "network failure",
+	39: "reactivation requested",
+	50: "PDP type IPv4 only allowed",
+	51: "PDP type IPv6 only allowed",
+}
+
+// callTypes names the ^CONN and ^ORIG <call_type>
+var callTypes = map[int]string{
+	0: "voice",
+	1: "CS data",
+	2: "PS data",
+	3: "CDMA SMS",
+	7: "OTA",
+	9: "emergency",
+}
+
+// ccCauses names common 3GPP TS 24.008 call control causes, as reported by
+// ^CEND
+var ccCauses = map[int]string{
+	1:   "unassigned number",
+	16:  "normal call clearing",
+	17:  "user busy",
+	18:  "no user responding",
+	19:  "no answer",
+	21:  "call rejected",
+	27:  "destination out of order",
+	31:  "normal, unspecified",
+	34:  "no circuit available",
+	38:  "network out of order",
+	41:  "temporary failure",
+	47:  "resources unavailable",
+	102: "recovery on timer expiry",
+}
+
+var (
+	simstRegex    = regexp.MustCompile(`\^SIMST:\s*(\d+)`)
+	srvstRegex    = regexp.MustCompile(`\^SRVST:\s*(\d+)`)
+	bootRegex     = regexp.MustCompile(`\^BOOT:\s*([^,\s]+)`)
+	ndisstatRegex = regexp.MustCompile(`\^NDISSTAT:\s*(\d+),\s*(\d*),\s*(\d*),\s*"?([^",]*)"?`)
+	connRegex     = regexp.MustCompile(`\^CONN:\s*(\d+),\s*(\d+)`)
+	cendRegex     = regexp.MustCompile(`\^CEND:\s*(\d+),\s*(\d+),\s*(\d+)(?:,\s*(\d+))?`)
+	rssilvlRegex  = regexp.MustCompile(`\^RSSILVL:\s*(\d+)`)
+)
+
+func init() {
+	registerURCParser("^SIMST:", parseSIMST)
+	registerURCParser("^SRVST:", parseSRVST)
+	registerURCParser("^BOOT:", parseBOOT)
+	registerURCParser("^NDISSTAT:", parseNDISSTAT)
+	registerURCParser("^CONN:", parseCONN)
+	registerURCParser("^CEND:", parseCEND)
+	registerURCParser("^RSSILVL:", parseRSSILVL)
+}
+
+// parseSIMST decodes ^SIMST: <sim_state>[,<lock_state>]
+func parseSIMST(line string) (urcResult, error) {
+	m := simstRegex.FindStringSubmatch(line)
+	if len(m) != 2 {
+		return nil, fmt.Errorf("malformed ^SIMST: %q", line)
+	}
+	sim := codeName(simStates, m[1])
+	return ServiceReport{Command: "^SIMST", SIMState: &sim}, nil
+}
+
+// parseSRVST decodes ^SRVST: <srv_status>
+func parseSRVST(line string) (urcResult, error) {
+	m := srvstRegex.FindStringSubmatch(line)
+	if len(m) != 2 {
+		return nil, fmt.Errorf("malformed ^SRVST: %q", line)
+	}
+	status := codeName(serviceStatuses, m[1])
+	return ServiceReport{Command: "^SRVST", Status: &status}, nil
+}
+
+// BootReport is a ^BOOT heartbeat. Older firmware repeats it periodically;
+// its first field only changes when the modem restarts.
+type BootReport struct {
+	Key string
+}
+
+func parseBOOT(line string) (urcResult, error) {
+	m := bootRegex.FindStringSubmatch(line)
+	if len(m) != 2 {
+		return nil, fmt.Errorf("malformed ^BOOT: %q", line)
+	}
+	return BootReport{Key: m[1]}, nil
+}
+
+func (r BootReport) apply(w *WebSocketClient) {
+	prev := w.bootKey
+	w.bootKey = r.Key
+	if prev != "" && prev != r.Key {
+		w.recordEvent(eventBoot, "Modem rebooted", map[string]string{"from": prev, "to": r.Key})
+	}
+}
+
+// DataSessionReport is a ^NDISSTAT change of the NDIS data connection
+type DataSessionReport struct {
+	State   string
+	Cause   string
+	PDPType string
+}
+
+// parseNDISSTAT decodes ^NDISSTAT: <stat>,[<err>],[<wx_state>],"<PDP_type>"
+func parseNDISSTAT(line string) (urcResult, error) {
+	m := ndisstatRegex.FindStringSubmatch(line)
+	if len(m) != 5 {
+		return nil, fmt.Errorf("malformed ^NDISSTAT: %q", line)
+	}
+	report := DataSessionReport{State: codeName(ndisStates, m[1]), PDPType: m[4]}
+	if m[2] != "" && m[2] != "0" {
+		report.Cause = causeName(smCauses, m[2])
+	}
+	return report, nil
+}
+
+// causeName is codeName for 3GPP causes, keeping the number next to the name
+func causeName(names map[int]string, field string) string {
+	code, _ := strconv.Atoi(field)
+	if name, ok := names[code]; ok {
+		return field + " (" + name + ")"
+	}
+	return field
+}
+
+func (r DataSessionReport) apply(w *WebSocketClient) {
+	message := "Data session " + r.State
+	if r.State == ndisStates[0] {
+		message = "Data session torn down"
+	}
+	if r.PDPType != "" {
+		message += " (" + r.PDPType + ")"
+	}
+	if r.Cause != "" {
+		message += " with cause " + r.Cause
+	}
+	w.recordEvent(eventDataSession, message, map[string]string{
+		"state":    r.State,
+		"cause":    r.Cause,
+		"pdp_type": r.PDPType,
+	})
+}
+
+// CallReport is a ^CONN or ^CEND for a call or data connection
+type CallReport struct {
+	Command  string
+	CallID   string
+	CallType string // ^CONN
+	Duration string // ^CEND, in seconds
+	End      string // ^CEND end status
+	Cause    string // ^CEND call control cause
+}
+
+// parseCONN decodes ^CONN: <call_x>,<call_type>
+func parseCONN(line string) (urcResult, error) {
+	m := connRegex.FindStringSubmatch(line)
+	if len(m) != 3 {
+		return nil, fmt.Errorf("malformed ^CONN: %q", line)
+	}
+	return CallReport{Command: "^CONN", CallID: m[1], CallType: codeName(callTypes, m[2])}, nil
+}
+
+// parseCEND decodes ^CEND: <call_x>,<duration>,<end_status>[,<cc_cause>]
+func parseCEND(line string) (urcResult, error) {
+	m := cendRegex.FindStringSubmatch(line)
+	if len(m) != 5 {
+		return nil, fmt.Errorf("malformed ^CEND: %q", line)
+	}
+	report := CallReport{Command: "^CEND", CallID: m[1], Duration: m[2], End: m[3]}
+	if m[4] != "" {
+		report.Cause = causeName(ccCauses, m[4])
+	}
+	return report, nil
+}
+
+func (r CallReport) apply(w *WebSocketClient) {
+	details := map[string]string{"call_id": r.CallID}
+	var message string
+	if r.Command == "^CONN" {
+		message = fmt.Sprintf("Call %s connected (%s)", r.CallID, r.CallType)
+		details["call_type"] = r.CallType
+	} else {
+		message = fmt.Sprintf("Call %s ended after %ss, end status %s", r.CallID, r.Duration, r.End)
+		if r.Cause != "" {
+			message += ", cause " + r.Cause
+		}
+		details["duration"], details["end_status"], details["cause"] = r.Duration, r.End, r.Cause
+	}
+	w.recordEvent(eventCall, message, details)
+}
+
+// SignalLevelReport is ^RSSILVL, on the +CSQ scale. Besides updating the
+// RSSI it records when the signal is lost or comes back.
+type SignalLevelReport struct {
+	RSSIReport
+}
+
+func parseRSSILVL(line string) (urcResult, error) {
+	m := rssilvlRegex.FindStringSubmatch(line)
+	if len(m) != 2 {
+		return nil, fmt.Errorf("malformed ^RSSILVL: %q", line)
+	}
+	level, _ := strconv.Atoi(m[1])
+	return SignalLevelReport{RSSIReport{RSSI: csqLevel(level)}}, nil
+}
+
+func (r SignalLevelReport) apply(w *WebSocketClient) {
+	w.modemStatus.mu.RLock()
+	hadSignal := w.modemStatus.RSSI != nil
+	w.modemStatus.mu.RUnlock()
+
+	r.RSSIReport.apply(w)
+
+	switch {
+	case hadSignal && r.RSSI == nil:
+		w.signalLost = true
+		w.recordEvent(eventSignal, "Signal lost", nil)
+	case w.signalLost && r.RSSI != nil:
+		w.signalLost = false
+		w.recordEvent(eventSignal, fmt.Sprintf("Signal restored at %s dBm", formatLevel(r.RSSI)), nil)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestParseConnectionEvents(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		parse   func(string) (urcResult, error)
+		line    string
+		want    urcResult
+		wantErr bool
+	}{
+		{parse: parseSIMST, line: "^SIMST: 1", want: ServiceReport{Command: "^SIMST", SIMState: str("valid")}},
+		{parse: parseSIMST, line: "^SIMST:255,1", want: ServiceReport{Command: "^SIMST", SIMState: str("not present")}},
+		{parse: parseSIMST, line: "^SIMST:", wantErr: true},
+		{parse: parseSRVST, line: "^SRVST: 2", want: ServiceReport{Command: "^SRVST", Status: str("valid service")}},
+		{parse: parseSRVST, line: "^SRVST:9", want: ServiceReport{Command: "^SRVST", Status: str("unknown (9)")}},
+		{parse: parseSRVST, line: "^SRVST: x", wantErr: true},
+		{parse: parseBOOT, line: "^BOOT:20452558,0,0,0,75", want: BootReport{Key: "20452558"}},
+		{parse: parseBOOT, line: "^BOOT:", wantErr: true},
+		{
+			parse: parseNDISSTAT,
+			line:  `^NDISSTAT: 1,,,"IPV4"`,
+			want:  DataSessionReport{State: "connected", PDPType: "IPV4"},
+		},
+		{
+			parse: parseNDISSTAT,
+			line:  `^NDISSTAT: 0,33,,"IPV4"`,
+			want:  DataSessionReport{State: "disconnected", Cause: "33 (service option not subscribed)", PDPType: "IPV4"},
+		},
+		{
+			parse: parseNDISSTAT,
+			line:  `^NDISSTAT: 0,0,0,IPV6`,
+			want:  DataSessionReport{State: "disconnected", PDPType: "IPV6"},
+		},
+		{
+			parse: parseNDISSTAT,
+			line:  `^NDISSTAT: 0,112,,"IPV4V6"`,
+			want:  DataSessionReport{State: "disconnected", Cause: "112", PDPType: "IPV4V6"},
+		},
+		{parse: parseNDISSTAT, line: "^NDISSTAT: 1", wantErr: true},
+		{parse: parseCONN, line: "^CONN: 1,2", want: CallReport{Command: "^CONN", CallID: "1", CallType: "PS data"}},
+		{parse: parseCONN, line: "^CONN:1,0", want: CallReport{Command: "^CONN", CallID: "1", CallType: "voice"}},
+		{parse: parseCONN, line: "^CONN: 1", wantErr: true},
+		{
+			parse: parseCEND,
+			line:  "^CEND: 1,125,104,16",
+			want:  CallReport{Command: "^CEND", CallID: "1", Duration: "125", End: "104", Cause: "16 (normal call clearing)"},
+		},
+		{
+			parse: parseCEND,
+			line:  "^CEND:1,0,29",
+			want:  CallReport{Command: "^CEND", CallID: "1", Duration: "0", End: "29"},
+		},
+		{
+			parse: parseCEND,
+			line:  "^CEND: 2,10,104,200",
+			want:  CallReport{Command: "^CEND", CallID: "2", Duration: "10", End: "104", Cause: "200"},
+		},
+		{parse: parseCEND, line: "^CEND: 1,125", wantErr: true},
+		{parse: parseRSSILVL, line: "^RSSILVL: 20", want: SignalLevelReport{RSSIReport{RSSI: csqLevel(20)}}},
+		{parse: parseRSSILVL, line: "^RSSILVL:99", want: SignalLevelReport{}},
+		{parse: parseRSSILVL, line: "^RSSILVL:", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.parse(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parse(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestConnectionEventsRecorded(t *testing.T) {
+	client, err := NewWebSocketClient(&Config{}, &ModemStatus{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"^BOOT:20452558,0,0,0,75",
+		"^BOOT:20452558,0,0,0,75", // heartbeat
+		"^BOOT:31337001,0,0,0,75", // restart
+		"^SIMST: 1",               // first report only sets the state
+		"^SIMST: 255",
+		"^SIMST: 1",
+		`^NDISSTAT: 0,36,,"IPV4"`,
+		"^CEND: 1,125,104,16",
+		"^RSSILVL: 20", // first report only sets the level
+		"^RSSILVL: 99",
+		"^RSSILVL: 99",
+		"^RSSILVL: 15",
+	} {
+		client.handleLine(line)
+	}
+
+	var got []string
+	for _, e := range client.Events() {
+		got = append(got, e.Type+": "+e.Message)
+	}
+	want := []string{
+		"boot: Modem rebooted",
+		"sim: SIM removed",
+		"sim: SIM inserted, valid",
+		"data_session: Data session torn down (IPV4) with cause 36 (regular deactivation)",
+		"call: Call 1 ended after 125s, end status 104, cause 16 (normal call clearing)",
+		"signal: Signal lost",
+		"signal: Signal restored at -83 dBm",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -33,6 +33,7 @@ const dashboardHTML = `
             font-size: 1.1rem; 
             opacity: 0.9;
         }
+        .header a { color: white; }
         .dashboard {
             display: grid;
             grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
@@ -81,6 +82,53 @@ const dashboardHTML = `
             height: 200px;
             margin-top: 15px;
         }
+        .modem-picker {
+            margin-top: 15px;
+        }
+        .modem-picker select {
+            font-size: 1rem;
+            padding: 6px 12px;
+            border-radius: 8px;
+            border: none;
+        }
+        .ussd-form { display: flex; gap: 8px; margin-bottom: 10px; }
+        .ussd-form input { flex: 1; padding: 6px 10px; border: 1px solid #ccc; border-radius: 6px; }
+        .ussd-form button {
+            padding: 6px 12px;
+            border: none;
+            border-radius: 6px;
+            background: #667eea;
+            color: white;
+            cursor: pointer;
+        }
+        .ussd-form button:disabled { background: #ccc; cursor: default; }
+        .ussd-reply {
+            white-space: pre-wrap;
+            background: #f8f9fa;
+            border-radius: 6px;
+            padding: 10px;
+            margin-bottom: 10px;
+            min-height: 40px;
+        }
+        .timeline { list-style: none; max-height: 360px; overflow-y: auto; }
+        .timeline li { padding: 6px 0; border-bottom: 1px solid #f0f0f0; }
+        .timeline .time { color: #888; font-size: 0.85rem; margin-right: 6px; }
+        .timeline .type {
+            display: inline-block;
+            font-size: 0.75rem;
+            padding: 1px 6px;
+            border-radius: 4px;
+            margin-right: 6px;
+            background: #e9ecef;
+            color: #555;
+        }
+        .timeline .type.connection, .timeline .type.boot, .timeline .type.sim { background: #f8d7da; color: #721c24; }
+        .timeline .type.service, .timeline .type.data_session, .timeline .type.signal { background: #fff3cd; color: #856404; }
+        .timeline .type.sms, .timeline .type.ussd { background: #d1ecf1; color: #0c5460; }
+        .modem-grid .card h2 {
+            display: flex;
+            justify-content: space-between;
+        }
         .last-update {
             text-align: center;
             color: #666;
@@ -94,10 +142,15 @@ const dashboardHTML = `
     <div class="container">
         <div class="header">
             <h1>📡 Modem Status Dashboard</h1>
-            <p>Real-time monitoring of modem connection and data flow</p>
+            <p>Real-time monitoring of modem connection and data flow · <a href="/inbox">SMS inbox</a></p>
+            <div class="modem-picker">
+                <select id="modem-select" onchange="selectModem(this.value)"></select>
+            </div>
         </div>
-        
-        <div class="dashboard">
+
+        <div class="dashboard modem-grid" id="modem-grid" style="display: none"></div>
+
+        <div class="dashboard" id="modem-detail">
             <!-- Connection Status Card -->
             <div class="card">
                 <h2>🔗 Connection Status</h2>
@@ -118,6 +171,84 @@ const dashboardHTML = `
                         <span class="status-label">Reconnects:</span>
                         <span class="status-value" id="reconnects">--</span>
                     </div>
+                    <div class="status-item">
+                        <span class="status-label">Latency (avg / p95):</span>
+                        <span class="status-value" id="latency">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Missed Pongs:</span>
+                        <span class="status-value" id="missed-pongs">--</span>
+                    </div>
+                </div>
+            </div>
+
+            <!-- Service Card -->
+            <div class="card">
+                <h2>🛰️ Service</h2>
+                <div id="service">
+                    <div class="status-item">
+                        <span class="status-label">Service:</span>
+                        <span class="status-value" id="service-status">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Operator:</span>
+                        <span class="status-value" id="operator">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Domain:</span>
+                        <span class="status-value" id="service-domain">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Roaming:</span>
+                        <span class="status-value" id="roaming">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">SIM:</span>
+                        <span class="status-value" id="sim-state">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Mode:</span>
+                        <span class="status-value" id="sys-mode">--</span>
+                    </div>
+                </div>
+            </div>
+
+            <!-- Serving Cell Card -->
+            <div class="card">
+                <h2>🗼 Serving Cell</h2>
+                <div id="serving-cell">
+                    <div class="status-item">
+                        <span class="status-label">Registration:</span>
+                        <span class="status-value" id="cell-registration">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Cell ID:</span>
+                        <span class="status-value" id="cell-id">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">eNB / Sector:</span>
+                        <span class="status-value" id="cell-enb">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">TAC / LAC:</span>
+                        <span class="status-value" id="cell-area">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">PCI:</span>
+                        <span class="status-value" id="cell-pci">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Band / EARFCN:</span>
+                        <span class="status-value" id="cell-band">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">DL / UL Frequency:</span>
+                        <span class="status-value" id="cell-freq">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Bandwidth:</span>
+                        <span class="status-value" id="cell-bw">--</span>
+                    </div>
                 </div>
             </div>
 
@@ -134,12 +265,12 @@ const dashboardHTML = `
                         <span class="status-value" id="rssi">--</span>
                     </div>
                     <div class="status-item">
-                        <span class="status-label">Signal Strength:</span>
-                        <span class="status-value" id="signal-strength">--</span>
+                        <span class="status-label">RSCP:</span>
+                        <span class="status-value" id="rscp">--</span>
                     </div>
                     <div class="status-item">
-                        <span class="status-label">Signal Quality:</span>
-                        <span class="status-value" id="signal-quality-value">--</span>
+                        <span class="status-label">Ec/Io:</span>
+                        <span class="status-value" id="ecio">--</span>
                     </div>
                     <div class="status-item">
                         <span class="status-label">RSRQ:</span>
@@ -149,6 +280,10 @@ const dashboardHTML = `
                         <span class="status-label">RSRP:</span>
                         <span class="status-value" id="rsrp">--</span>
                     </div>
+                    <div class="status-item">
+                        <span class="status-label">SINR:</span>
+                        <span class="status-value" id="sinr">--</span>
+                    </div>
                 </div>
             </div>
 
@@ -157,11 +292,15 @@ const dashboardHTML = `
                 <h2>📊 Data Flow</h2>
                 <div id="data-flow">
                     <div class="status-item">
-                        <span class="status-label">Upload Total:</span>
+                        <span class="status-label">Session Duration:</span>
+                        <span class="status-value" id="session-duration">--</span>
+                    </div>
+                    <div class="status-item">
+                        <span class="status-label">Session Upload:</span>
                         <span class="status-value" id="total-ul">--</span>
                     </div>
                     <div class="status-item">
-                        <span class="status-label">Download Total:</span>
+                        <span class="status-label">Session Download:</span>
                         <span class="status-value" id="total-dl">--</span>
                     </div>
                     <div class="status-item">
@@ -172,11 +311,43 @@ const dashboardHTML = `
                         <span class="status-label">Last DL Rate:</span>
                         <span class="status-value" id="dl-rate">--</span>
                     </div>
+                    <div class="status-item">
+                        <span class="status-label">QoS UL / DL:</span>
+                        <span class="status-value" id="qos-rate">--</span>
+                    </div>
                 </div>
                 <div class="chart-container">
                     <canvas id="dataFlowChart"></canvas>
                 </div>
             </div>
+
+            <!-- USSD Card -->
+            <div class="card">
+                <h2>☎️ USSD</h2>
+                <form class="ussd-form" onsubmit="sendUSSD(); return false;">
+                    <input id="ussd-code" placeholder="*100#" autocomplete="off">
+                    <button type="submit">Send</button>
+                    <button type="button" id="ussd-cancel" onclick="cancelUSSD()" disabled>End</button>
+                </form>
+                <div class="ussd-reply" id="ussd-reply">--</div>
+                <div class="status-item">
+                    <span class="status-label">Scheduled:</span>
+                    <select id="ussd-query" onchange="updateUSSDChart()"></select>
+                </div>
+                <div class="status-item">
+                    <span class="status-label">Last Result:</span>
+                    <span class="status-value" id="ussd-last">--</span>
+                </div>
+                <div class="chart-container">
+                    <canvas id="ussdChart"></canvas>
+                </div>
+            </div>
+
+            <!-- Timeline Card -->
+            <div class="card">
+                <h2>🕒 Timeline</h2>
+                <ul class="timeline" id="timeline"></ul>
+            </div>
         </div>
 
         <div class="last-update">
@@ -186,9 +357,48 @@ const dashboardHTML = `
 
     <script>
         let dataFlowChart = null;
-        
+        let ussdChart = null;
+        let ussdState = null;
+        let currentModem = null;
+
+        function loadModems() {
+            fetch('/api/modems')
+                .then(response => response.json())
+                .then(modems => {
+                    const select = document.getElementById('modem-select');
+                    select.innerHTML = '';
+                    modems.forEach(m => select.add(new Option(m.id + ' (' + m.source + ')', m.id)));
+                    if (modems.length > 1) {
+                        select.add(new Option('All modems side by side', 'all'));
+                    }
+                    select.parentElement.style.display = modems.length > 1 ? '' : 'none';
+                    const hash = decodeURIComponent(location.hash.slice(1));
+                    if (hash && Array.from(select.options).some(o => o.value === hash)) {
+                        select.value = hash;
+                    }
+                    selectModem(select.value);
+                })
+                .catch(error => console.error('Error fetching modems:', error));
+        }
+
+        function selectModem(id) {
+            currentModem = id;
+            location.hash = id;
+            document.getElementById('modem-grid').style.display = id === 'all' ? '' : 'none';
+            document.getElementById('modem-detail').style.display = id === 'all' ? 'none' : '';
+            updateDashboard();
+        }
+
         function updateDashboard() {
-            fetch('/api/status')
+            if (!currentModem) return;
+            if (currentModem === 'all') {
+                updateModemGrid();
+                return;
+            }
+
+            updateUSSD();
+            updateTimeline();
+            fetch('/api/modems/' + encodeURIComponent(currentModem) + '/status')
                 .then(response => response.json())
                 .then(data => {
                     // Update connection status
@@ -204,23 +414,71 @@ const dashboardHTML = `
                     document.getElementById('reconnects').textContent = 
                         data.connection_stats.total_reconnects;
 
+                    const latency = data.connection_stats.latency;
+                    document.getElementById('latency').textContent = latency && latency.samples > 0
+                        ? latency.avg_ms.toFixed(1) + ' / ' + latency.p95_ms.toFixed(1) + ' ms'
+                        : '--';
+                    document.getElementById('missed-pongs').textContent = latency
+                        ? latency.missed_pongs + (latency.consecutive_missed > 0 ? ' (' + latency.consecutive_missed + ' in a row)' : '')
+                        : '--';
+
+                    // Update service state
+                    const service = data.service || {};
+                    const serviceStatus = document.getElementById('service-status');
+                    serviceStatus.textContent = service.status || '--';
+                    serviceStatus.className = 'status-value ' + serviceClass(service.status);
+                    const op = data.operator || {};
+                    document.getElementById('operator').textContent = op.name || op.plmn
+                        ? (op.name || op.plmn) + (op.plmn && op.name ? ' (' + op.plmn + ')' : '') + (op.country ? ', ' + op.country : '')
+                        : '--';
+                    document.getElementById('service-domain').textContent = service.domain || '--';
+                    document.getElementById('roaming').textContent = service.status ? (service.roaming ? 'Yes' : 'No') : '--';
+                    document.getElementById('sim-state').textContent = service.sim_state || '--';
+                    document.getElementById('sys-mode').textContent = service.sysmode
+                        ? service.sysmode + (service.submode && service.submode !== service.sysmode ? ' (' + service.submode + ')' : '')
+                        : '--';
+
+                    // Update serving cell
+                    const cell = data.cell || {};
+                    document.getElementById('cell-registration').textContent = cell.registration || '--';
+                    document.getElementById('cell-id').textContent = cell.cell_id
+                        ? cell.cell_id + ' (' + parseInt(cell.cell_id, 16) + ')'
+                        : '--';
+                    document.getElementById('cell-enb').textContent = cell.enodeb_id !== undefined
+                        ? cell.enodeb_id + ' / ' + cell.sector
+                        : (cell.rnc_id !== undefined ? 'RNC ' + cell.rnc_id : '--');
+                    document.getElementById('cell-area').textContent = cell.tac || cell.lac || '--';
+                    document.getElementById('cell-pci').textContent = cell.pci !== undefined ? cell.pci : '--';
+                    document.getElementById('cell-band').textContent = cell.band
+                        ? 'B' + cell.band + (cell.dl_earfcn !== undefined ? ' / ' + cell.dl_earfcn : '')
+                        : '--';
+                    document.getElementById('cell-freq').textContent = cell.dl_freq_mhz
+                        ? cell.dl_freq_mhz + ' / ' + (cell.ul_freq_mhz || '--') + ' MHz'
+                        : '--';
+                    document.getElementById('cell-bw').textContent = cell.dl_bandwidth_mhz
+                        ? cell.dl_bandwidth_mhz + ' MHz'
+                        : '--';
+
                     // Update signal quality
                     document.getElementById('network-type').textContent = data.network_type || '--';
-                    document.getElementById('rssi').textContent = data.rssi !== 0 ? data.rssi + ' dBm' : '--';
-                    document.getElementById('signal-strength').textContent = 
-                        data.signal_strength !== 0 ? data.signal_strength + '%' : '--';
-                    document.getElementById('signal-quality-value').textContent = 
-                        data.signal_quality !== 0 ? data.signal_quality + '%' : '--';
-                    document.getElementById('rsrq').textContent = data.rsrq !== 0 ? data.rsrq : '--';
-                    document.getElementById('rsrp').textContent = data.rsrp !== 0 ? data.rsrp + ' dBm' : '--';
+                    document.getElementById('rssi').textContent = formatLevel(data.rssi, 'dBm');
+                    document.getElementById('rscp').textContent = formatLevel(data.rscp, 'dBm');
+                    document.getElementById('ecio').textContent = formatLevel(data.ecio, 'dB');
+                    document.getElementById('rsrq').textContent = formatLevel(data.rsrq, 'dB');
+                    document.getElementById('rsrp').textContent = formatLevel(data.rsrp, 'dBm');
+                    document.getElementById('sinr').textContent = formatLevel(data.sinr, 'dB');
 
                     // Update data flow
                     if (data.data_flow && data.data_flow.length > 0) {
                         const latest = data.data_flow[data.data_flow.length - 1];
-                        document.getElementById('total-ul').textContent = formatBytes(latest.total_ul);
-                        document.getElementById('total-dl').textContent = formatBytes(latest.total_dl);
-                        document.getElementById('ul-rate').textContent = formatBytes(latest.ul_rate) + '/s';
-                        document.getElementById('dl-rate').textContent = formatBytes(latest.dl_rate) + '/s';
+                        document.getElementById('session-duration').textContent = formatDuration(latest.duration * 1000);
+                        document.getElementById('total-ul').textContent = formatBytes(latest.ul_bytes);
+                        document.getElementById('total-dl').textContent = formatBytes(latest.dl_bytes);
+                        document.getElementById('ul-rate').textContent = formatBits(latest.ul_rate * 8);
+                        document.getElementById('dl-rate').textContent = formatBits(latest.dl_rate * 8);
+                        document.getElementById('qos-rate').textContent = latest.qos_ul_rate || latest.qos_dl_rate
+                            ? formatBits(latest.qos_ul_rate * 8) + ' / ' + formatBits(latest.qos_dl_rate * 8)
+                            : '--';
                         
                         updateChart(data.data_flow);
                     }
@@ -234,11 +492,64 @@ const dashboardHTML = `
                 });
         }
 
+        function updateModemGrid() {
+            fetch('/api/modems')
+                .then(response => response.json())
+                .then(modems => {
+                    const grid = document.getElementById('modem-grid');
+                    grid.innerHTML = '';
+                    modems.forEach(m => {
+                        const card = document.createElement('div');
+                        card.className = 'card';
+                        card.onclick = () => {
+                            document.getElementById('modem-select').value = m.id;
+                            selectModem(m.id);
+                        };
+
+                        const title = document.createElement('h2');
+                        title.textContent = '📡 ' + m.id;
+                        const state = document.createElement('span');
+                        state.textContent = m.is_connected ? '🟢' : '🔴';
+                        title.appendChild(state);
+                        card.appendChild(title);
+
+                        [
+                            ['Source', m.source],
+                            ['Network Type', m.network_type || '--'],
+                            ['Operator', m.operator || '--'],
+                            ['Cell', m.cell || '--'],
+                            ['Service', m.service ? m.service + (m.roaming ? ' (roaming)' : '') : '--'],
+                            ['RSSI', formatLevel(m.rssi, 'dBm')],
+                            ['RSRP', formatLevel(m.rsrp, 'dBm')],
+                            ['RSRQ', formatLevel(m.rsrq, 'dB')],
+                            ['SINR', formatLevel(m.sinr, 'dB')],
+                            ['Reconnects', m.total_reconnects],
+                            ['Last Update', new Date(m.last_update).toLocaleTimeString()]
+                        ].forEach(([label, value]) => {
+                            const item = document.createElement('div');
+                            item.className = 'status-item';
+                            const l = document.createElement('span');
+                            l.className = 'status-label';
+                            l.textContent = label + ':';
+                            const v = document.createElement('span');
+                            v.className = 'status-value';
+                            v.textContent = value;
+                            item.appendChild(l);
+                            item.appendChild(v);
+                            card.appendChild(item);
+                        });
+                        grid.appendChild(card);
+                    });
+                    document.getElementById('update-time').textContent = new Date().toLocaleTimeString();
+                })
+                .catch(error => console.error('Error fetching modems:', error));
+        }
+
         function updateChart(flowData) {
             const ctx = document.getElementById('dataFlowChart').getContext('2d');
             const labels = flowData.slice(-20).map((_, index) => ` + "`" + `T-${19-index}` + "`" + `);
-            const ulData = flowData.slice(-20).map(d => d.ul_bytes);
-            const dlData = flowData.slice(-20).map(d => d.dl_bytes);
+            const ulData = flowData.slice(-20).map(d => d.ul_rate * 8);
+            const dlData = flowData.slice(-20).map(d => d.dl_rate * 8);
 
             if (dataFlowChart) {
                 dataFlowChart.destroy();
@@ -273,7 +584,7 @@ const dashboardHTML = `
                             beginAtZero: true,
                             title: {
                                 display: true,
-                                text: 'Bytes'
+                                text: 'bits/s'
                             }
                         }
                     }
@@ -281,6 +592,130 @@ const dashboardHTML = `
             });
         }
 
+        function updateTimeline() {
+            fetch('/api/modems/' + encodeURIComponent(currentModem) + '/events?limit=30')
+                .then(response => response.json())
+                .then(events => {
+                    const list = document.getElementById('timeline');
+                    list.innerHTML = '';
+                    if (events.length === 0) {
+                        const item = document.createElement('li');
+                        item.textContent = 'No events yet';
+                        list.appendChild(item);
+                        return;
+                    }
+                    events.reverse().forEach(e => {
+                        const item = document.createElement('li');
+                        const time = document.createElement('span');
+                        time.className = 'time';
+                        time.textContent = new Date(e.time).toLocaleString();
+                        const type = document.createElement('span');
+                        type.className = 'type ' + e.type;
+                        type.textContent = e.type.replace('_', ' ');
+                        item.appendChild(time);
+                        item.appendChild(type);
+                        item.appendChild(document.createTextNode(e.message));
+                        list.appendChild(item);
+                    });
+                })
+                .catch(error => console.error('Error fetching events:', error));
+        }
+
+        function ussdURL() {
+            return '/api/modems/' + encodeURIComponent(currentModem) + '/ussd';
+        }
+
+        function showUSSDReply(reply) {
+            let text = reply.text || reply.error || reply.status;
+            if (reply.session_open) {
+                text += '\n(reply to continue)';
+            }
+            document.getElementById('ussd-reply').textContent = text;
+            document.getElementById('ussd-cancel').disabled = !reply.session_open;
+        }
+
+        function sendUSSD() {
+            const input = document.getElementById('ussd-code');
+            const code = input.value.trim();
+            if (!code || !currentModem) return;
+            document.getElementById('ussd-reply').textContent = 'Waiting for the network...';
+            fetch(ussdURL(), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code: code })
+            })
+                .then(response => response.json())
+                .then(reply => {
+                    input.value = '';
+                    showUSSDReply(reply);
+                })
+                .catch(error => {
+                    console.error('Error sending USSD:', error);
+                    document.getElementById('ussd-reply').textContent = 'Request failed';
+                });
+        }
+
+        function cancelUSSD() {
+            fetch(ussdURL(), { method: 'DELETE' })
+                .then(response => response.json())
+                .then(showUSSDReply)
+                .catch(error => console.error('Error ending USSD session:', error));
+        }
+
+        function updateUSSD() {
+            fetch(ussdURL())
+                .then(response => response.json())
+                .then(state => {
+                    ussdState = state;
+                    document.getElementById('ussd-cancel').disabled = !state.session_open;
+                    const select = document.getElementById('ussd-query');
+                    const names = state.queries.map(q => q.name);
+                    if (Array.from(select.options).map(o => o.value).join() !== names.join()) {
+                        select.innerHTML = '';
+                        names.forEach(name => select.add(new Option(name, name)));
+                    }
+                    select.parentElement.style.display = names.length ? '' : 'none';
+                    updateUSSDChart();
+                })
+                .catch(error => console.error('Error fetching USSD state:', error));
+        }
+
+        function updateUSSDChart() {
+            const query = ussdState && ussdState.queries.find(q => q.name === document.getElementById('ussd-query').value);
+            const results = query ? query.results : [];
+            const last = results[results.length - 1];
+            document.getElementById('ussd-last').textContent =
+                last ? (last.error || last.text) + ' (' + new Date(last.time).toLocaleString() + ')' : '--';
+
+            const points = results.filter(r => r.value !== undefined);
+            const labels = points.map(r => new Date(r.time).toLocaleDateString());
+            const values = points.map(r => r.value);
+            if (ussdChart && ussdChart.data.labels.join() === labels.join() &&
+                ussdChart.data.datasets[0].label === (query ? query.name : '')) {
+                return;
+            }
+            if (ussdChart) {
+                ussdChart.destroy();
+            }
+            ussdChart = new Chart(document.getElementById('ussdChart').getContext('2d'), {
+                type: 'line',
+                data: {
+                    labels: labels,
+                    datasets: [{
+                        label: query ? query.name : '',
+                        data: values,
+                        borderColor: 'rgb(118, 75, 162)',
+                        backgroundColor: 'rgba(118, 75, 162, 0.1)',
+                        tension: 0.2
+                    }]
+                },
+                options: {
+                    responsive: true,
+                    maintainAspectRatio: false
+                }
+            });
+        }
+
         function formatDuration(duration) {
             if (!duration) return '--';
             const seconds = Math.floor(duration / 1000);
@@ -298,9 +733,30 @@ const dashboardHTML = `
             return parseFloat((bytes / Math.pow(k, i)).toFixed(2)) + ' ' + sizes[i];
         }
 
+        function formatBits(bits) {
+            if (!bits) return '0 bit/s';
+            const k = 1000;
+            const sizes = ['bit/s', 'kbit/s', 'Mbit/s', 'Gbit/s'];
+            const i = Math.min(Math.floor(Math.log(bits) / Math.log(k)), sizes.length - 1);
+            return parseFloat((bits / Math.pow(k, i)).toFixed(2)) + ' ' + sizes[i];
+        }
+
+        function serviceClass(status) {
+            if (status === 'valid service') return 'signal-excellent';
+            if (status === 'limited service' || status === 'limited regional service') return 'signal-fair';
+            if (status === 'no service') return 'signal-poor';
+            return '';
+        }
+
+        // Levels the current network does not report are absent from the JSON
+        function formatLevel(value, unit) {
+            if (value === undefined || value === null) return '--';
+            return value + ' ' + unit;
+        }
+
         // Update dashboard every 2 seconds
         setInterval(updateDashboard, 2000);
-        updateDashboard(); // Initial update
+        loadModems(); // Initial update
     </script>
 </body>
 </html>
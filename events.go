@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventHistory is the number of events kept per modem
+const eventHistory = 500
+
+// Event types
+const (
+	eventConnection     = "connection"
+	eventOperatorChange = "operator_change"
+	eventHandover       = "handover"
+	eventSIM            = "sim"
+	eventService        = "service"
+	eventBoot           = "boot"
+	eventDataSession    = "data_session"
+	eventCall           = "call"
+	eventSignal         = "signal"
+	eventSMS            = "sms"
+	eventSMSSent        = "sms_sent"
+	eventUSSD           = "ussd"
+)
+
+// Event is a notable change in the modem's state
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Type    string            `json:"type"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// eventLog is a ring buffer of the most recent events
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+}
+
+func (l *eventLog) add(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) < eventHistory {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % eventHistory
+}
+
+// list returns the events oldest first
+func (l *eventLog) list() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+// recordEvent logs an event and adds it to the modem's history
+func (w *WebSocketClient) recordEvent(eventType, message string, details map[string]string) {
+	w.events.add(Event{
+		Time:    time.Now(),
+		Type:    eventType,
+		Message: message,
+		Details: details,
+	})
+	w.logger.Printf("INFO: Event %s: %s", eventType, message)
+}
+
+// Events returns the modem's event history, oldest first
+func (w *WebSocketClient) Events() []Event {
+	return w.events.list()
+}
+
+// handleEventsAPI serves the event history, oldest first. It can be narrowed
+// with ?type=sim,boot, ?since=<RFC 3339 time> and ?limit=<newest n>.
+func (s *Server) handleEventsAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	query := r.URL.Query()
+	var types map[string]bool
+	if list := query.Get("type"); list != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(list, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events := []Event{}
+	for _, e := range m.Client.Events() {
+		if (types == nil || types[e.Type]) && e.Time.After(since) {
+			events = append(events, e)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEventLogWraparound(t *testing.T) {
+	var l eventLog
+	for i := 0; i < 10; i++ {
+		l.add(Event{Message: strconv.Itoa(i)})
+	}
+	if events := l.list(); len(events) != 10 || events[0].Message != "0" || events[9].Message != "9" {
+		t.Fatalf("before wraparound: %d events, %q..%q", len(events), events[0].Message, events[len(events)-1].Message)
+	}
+
+	for i := 10; i < eventHistory+25; i++ {
+		l.add(Event{Message: strconv.Itoa(i)})
+	}
+	events := l.list()
+	if len(events) != eventHistory {
+		t.Fatalf("%d events kept, want %d", len(events), eventHistory)
+	}
+	for i, e := range events {
+		if want := strconv.Itoa(i + 25); e.Message != want {
+			t.Fatalf("events[%d] = %q, want %q", i, e.Message, want)
+		}
+	}
+}
+
+func TestEventsAPI(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	s := newTestServer(t, client)
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, eventType := range []string{eventBoot, eventSIM, eventService, eventSIM, eventBoot, eventCall} {
+		client.events.add(Event{Time: start.Add(time.Duration(i) * time.Minute), Type: eventType, Message: strconv.Itoa(i)})
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"0", "1", "2", "3", "4", "5"}},
+		{query: "?type=sim", want: []string{"1", "3"}},
+		{query: "?type=sim,%20boot", want: []string{"0", "1", "3", "4"}},
+		{query: "?type=ussd", want: []string{}},
+		{query: "?since=2025-01-01T12:02:00Z", want: []string{"3", "4", "5"}},
+		{query: "?since=2025-01-01T13:01:00%2B01:00", want: []string{"2", "3", "4", "5"}},
+		{query: "?limit=2", want: []string{"4", "5"}},
+		{query: "?limit=0", want: []string{"0", "1", "2", "3", "4", "5"}},
+		{query: "?limit=10", want: []string{"0", "1", "2", "3", "4", "5"}},
+		{query: "?type=boot,sim&since=2025-01-01T12:00:00Z&limit=2", want: []string{"3", "4"}},
+	}
+	for _, tt := range tests {
+		var events []Event
+		getJSON(t, s, "/api/events"+tt.query, &events)
+		got := []string{}
+		for _, e := range events {
+			got = append(got, e.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /api/events%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"?since=yesterday", "?limit=-1", "?limit=x"} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/events"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/events%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPartialLine bounds an unterminated line before it is discarded
+	maxPartialLine = 64 * 1024
+	// maxQuotedLines bounds how many physical lines a quoted string may span
+	maxQuotedLines = 16
+	// partialLineTimeout is how long an unterminated line may wait for the
+	// rest of it before being handled as complete
+	partialLineTimeout = 250 * time.Millisecond
+)
+
+// multiLineHeaders introduce a response whose body is the following line,
+// e.g. the PDU after +CMGL/+CMGR/+CMT
+var multiLineHeaders = []string{"+CMGL:", "+CMGR:", "+CMT:", "+CDS:"}
+
+// lineFramer reassembles modem output into logical lines. Frames may carry a
+// fraction of a line or several lines; lines end with CR, LF or both. A
+// logical line is one of:
+//
+//   - a single result line, e.g. `^RSSI:20`
+//   - a result whose quoted string spans lines, joined with "\n",
+//     e.g. a multi-line `+CUSD:` reply
+//   - a multi-line response header followed by "\n" and its body,
+//     e.g. `+CMGL: 1,0,,23` + "\n" + PDU
+//   - the SMS input prompt "> ", which has no line terminator
+//
+// Echoed commands are dropped.
+type lineFramer struct {
+	buf    []byte
+	header string   // multi-line header waiting for its body
+	quoted []string // lines of an unterminated quoted string
+}
+
+// Feed appends a frame and returns the logical lines it completes. An
+// unterminated tail stays buffered until a later frame ends it or Flush is
+// called.
+func (f *lineFramer) Feed(data []byte) []string {
+	f.buf = append(f.buf, data...)
+
+	var lines []string
+	for {
+		i := bytes.IndexAny(f.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimSpace(f.buf[:i]))
+		f.buf = f.buf[i+1:]
+		if line != "" {
+			lines = f.push(lines, line)
+		}
+	}
+
+	if bytes.Equal(f.buf, []byte("> ")) {
+		f.buf = f.buf[:0]
+		lines = f.flushPending(lines)
+		lines = append(lines, "> ")
+	}
+
+	if len(f.buf) > maxPartialLine {
+		f.buf = f.buf[:0]
+	}
+
+	// Do not keep a reference to a large frame
+	if len(f.buf) == 0 {
+		f.buf = nil
+	}
+	return lines
+}
+
+// Flush treats a buffered partial line as complete. It is used when the
+// rest of a line split across frames never arrives.
+func (f *lineFramer) Flush() []string {
+	var lines []string
+	if line := string(bytes.TrimSpace(f.buf)); line != "" {
+		lines = f.push(lines, line)
+	}
+	f.buf = nil
+	return lines
+}
+
+// Pending reports whether part of a line is buffered
+func (f *lineFramer) Pending() bool {
+	return len(f.buf) > 0
+}
+
+// Reset drops all buffered state, e.g. after a reconnect
+func (f *lineFramer) Reset() {
+	f.buf = nil
+	f.header = ""
+	f.quoted = nil
+}
+
+func (f *lineFramer) push(lines []string, line string) []string {
+	// Continuation of a quoted string
+	if len(f.quoted) > 0 {
+		f.quoted = append(f.quoted, line)
+		if strings.Count(line, `"`)%2 == 1 || len(f.quoted) >= maxQuotedLines {
+			lines = append(lines, strings.Join(f.quoted, "\n"))
+			f.quoted = nil
+		}
+		return lines
+	}
+
+	// Body of a multi-line response, unless the modem went straight to the
+	// final result
+	if f.header != "" {
+		header := f.header
+		f.header = ""
+		if done, _ := finalResult(line); !done {
+			return append(lines, header+"\n"+line)
+		}
+		lines = append(lines, header)
+	}
+
+	if isEcho(line) {
+		return lines
+	}
+
+	for _, prefix := range multiLineHeaders {
+		if strings.HasPrefix(line, prefix) {
+			f.header = line
+			return lines
+		}
+	}
+
+	if (line[0] == '+' || line[0] == '^') && strings.Count(line, `"`)%2 == 1 {
+		f.quoted = []string{line}
+		return lines
+	}
+
+	return append(lines, line)
+}
+
+func (f *lineFramer) flushPending(lines []string) []string {
+	if f.header != "" {
+		lines = append(lines, f.header)
+		f.header = ""
+	}
+	if len(f.quoted) > 0 {
+		lines = append(lines, strings.Join(f.quoted, "\n"))
+		f.quoted = nil
+	}
+	return lines
+}
+
+// isEcho reports whether line is a command echoed back with ATE1. Modem
+// responses never start with "AT".
+func isEcho(line string) bool {
+	return len(line) >= 2 && strings.EqualFold(line[:2], "AT")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineFramer(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []string
+		want   []string
+	}{
+		{
+			name:   "lines split across frames",
+			frames: []string{"AT+COPS?\r\r\n+COPS: 0,0,\"MTS RUS", "\",7\r\n\r\nOK\r\n^HCSQ:\"LTE\",", "50,40,100,20\r\n"},
+			want:   []string{`+COPS: 0,0,"MTS RUS",7`, "OK", `^HCSQ:"LTE",50,40,100,20`},
+		},
+		{
+			name:   "split starting at a line boundary",
+			frames: []string{"OK\r\n", `^HCSQ:"LTE",50`, ",40,100,20\r\n"},
+			want:   []string{"OK", `^HCSQ:"LTE",50,40,100,20`},
+		},
+		{
+			name:   "quoted string split at a line boundary",
+			frames: []string{"OK\r\n", `+COPS: 0,0,"MTS`, ` RUS",7`, "\r\nOK\r\n"},
+			want:   []string{"OK", `+COPS: 0,0,"MTS RUS",7`, "OK"},
+		},
+		{
+			name:   "unterminated tail continued by a frame without terminators",
+			frames: []string{"\r\n^DSFLOWRPT:0000", "1234,00000000", "\r\n"},
+			want:   []string{"^DSFLOWRPT:00001234,00000000"},
+		},
+		{
+			name:   "multi-line response bodies",
+			frames: []string{"+CMGL: 1,0,,23\r\n0791", "AB\r\n+CMGL: 2,1,,5\r\n00AA\r\nOK\r\n", "+CMGR: 0,,0\r\nOK\r\n"},
+			want:   []string{"+CMGL: 1,0,,23\n0791AB", "+CMGL: 2,1,,5\n00AA", "OK", "+CMGR: 0,,0", "OK"},
+		},
+		{
+			name:   "multi-line response body in its own frame",
+			frames: []string{"+CMT: ,24\r\n", "0791447758100650040C91\r\n"},
+			want:   []string{"+CMT: ,24\n0791447758100650040C91"},
+		},
+		{
+			name:   "quoted string spanning lines",
+			frames: []string{"+CUSD: 0,\"Balance: 10\r\nValid to 12.12\",15\r\n"},
+			want:   []string{"+CUSD: 0,\"Balance: 10\nValid to 12.12\",15"},
+		},
+		{
+			name:   "SMS prompt",
+			frames: []string{"AT+CMGS=23\r\r\n> "},
+			want:   []string{"> "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f lineFramer
+			var got []string
+			for _, frame := range tt.frames {
+				got = append(got, f.Feed([]byte(frame))...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if f.Pending() {
+				t.Errorf("partial line left pending: %q", f.buf)
+			}
+		})
+	}
+}
+
+func TestLineFramerFlush(t *testing.T) {
+	var f lineFramer
+	if lines := f.Feed([]byte("OK\r\n^RSSI:")); !reflect.DeepEqual(lines, []string{"OK"}) {
+		t.Fatalf("Feed() = %q", lines)
+	}
+	if !f.Pending() {
+		t.Fatal("expected a pending partial line")
+	}
+	if lines := f.Flush(); !reflect.DeepEqual(lines, []string{"^RSSI:"}) {
+		t.Errorf("Flush() = %q", lines)
+	}
+}
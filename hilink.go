@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HiLink API error codes that mean the session or token has to be refreshed
+const (
+	hilinkErrTokenInvalid   = 125002
+	hilinkErrSessionTimeout = 125003
+)
+
+// hilinkNetworkTypesEx maps CurrentNetworkTypeEx codes to names
+var hilinkNetworkTypesEx = map[string]string{
+	"0": "NO SERVICE", "1": "GSM", "2": "GPRS", "3": "EDGE",
+	"41": "WCDMA", "42": "HSDPA", "43": "HSUPA", "44": "HSPA", "45": "HSPA+", "46": "DC-HSPA+",
+	"61": "TD-SCDMA", "62": "TD-HSDPA", "63": "TD-HSUPA", "64": "TD-HSPA", "65": "TD-HSPA+",
+	"101": "LTE", "1011": "LTE+",
+}
+
+// hilinkNetworkTypes maps the older CurrentNetworkType codes to names
+var hilinkNetworkTypes = map[string]string{
+	"0": "NO SERVICE", "1": "GSM", "2": "GPRS", "3": "EDGE", "4": "WCDMA",
+	"5": "HSDPA", "6": "HSUPA", "7": "HSPA", "8": "TD-SCDMA", "9": "HSPA+",
+	"17": "HSPA+", "18": "HSPA+", "19": "LTE",
+}
+
+// hilinkSignal is the body of /api/device/signal
+type hilinkSignal struct {
+	PCI    string `xml:"pci"`
+	CellID string `xml:"cell_id"`
+	RSSI   string `xml:"rssi"`
+	RSRP   string `xml:"rsrp"`
+	RSRQ   string `xml:"rsrq"`
+	SINR   string `xml:"sinr"`
+	RSCP   string `xml:"rscp"`
+	ECIO   string `xml:"ecio"`
+	Mode   string `xml:"mode"`
+}
+
+// hilinkMonitoringStatus is the body of /api/monitoring/status
+type hilinkMonitoringStatus struct {
+	ConnectionStatus     string `xml:"ConnectionStatus"`
+	SignalIcon           string `xml:"SignalIcon"`
+	CurrentNetworkType   string `xml:"CurrentNetworkType"`
+	CurrentNetworkTypeEx string `xml:"CurrentNetworkTypeEx"`
+}
+
+// hilinkTraffic is the body of /api/monitoring/traffic-statistics
+type hilinkTraffic struct {
+	CurrentConnectTime  int64 `xml:"CurrentConnectTime"`
+	CurrentUpload       int64 `xml:"CurrentUpload"`
+	CurrentDownload     int64 `xml:"CurrentDownload"`
+	CurrentUploadRate   int64 `xml:"CurrentUploadRate"`
+	CurrentDownloadRate int64 `xml:"CurrentDownloadRate"`
+	TotalUpload         int64 `xml:"TotalUpload"`
+	TotalDownload       int64 `xml:"TotalDownload"`
+	TotalConnectTime    int64 `xml:"TotalConnectTime"`
+}
+
+// hilinkSnapshot is the report a hilinkSource hands to the client: one poll
+// of every endpoint
+type hilinkSnapshot struct {
+	Time    time.Time
+	Signal  hilinkSignal
+	Status  hilinkMonitoringStatus
+	Traffic hilinkTraffic
+}
+
+// hilinkError is returned by the API in place of a <response> document
+type hilinkError struct {
+	Code    int    `xml:"code"`
+	Message string `xml:"message"`
+}
+
+func (e *hilinkError) Error() string {
+	return fmt.Sprintf("HiLink API error %d %s", e.Code, e.Message)
+}
+
+// hilinkSource polls the HiLink web API of modems without an AT port
+type hilinkSource struct {
+	config *Config
+	logger *log.Logger
+	client *http.Client
+
+	mu       sync.Mutex // guards session, token, ctx and done
+	session  string
+	token    string
+	ctx      context.Context
+	done     chan struct{}
+	lastPoll time.Time
+}
+
+func newHiLinkSource(config *Config, logger *log.Logger) *hilinkSource {
+	return &hilinkSource{
+		config: config,
+		logger: logger,
+		client: &http.Client{Timeout: config.RequestTimeout},
+	}
+}
+
+func (s *hilinkSource) String() string {
+	return "hilink " + s.config.HiLinkURL
+}
+
+func (s *hilinkSource) Connect(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.done = make(chan struct{})
+	s.lastPoll = time.Time{}
+	s.mu.Unlock()
+
+	if err := s.refreshSession(ctx); err != nil {
+		return fmt.Errorf("failed to open HiLink session: %v", err)
+	}
+	return nil
+}
+
+// ReadFrame is not supported: the API has no AT output, only the reports
+// returned by ReadReport
+func (s *hilinkSource) ReadFrame() ([]byte, error) {
+	return nil, fmt.Errorf("%s delivers reports, not frames", s)
+}
+
+// ReadReport waits for the next poll slot and returns a hilinkSnapshot
+func (s *hilinkSource) ReadReport() (urcResult, error) {
+	s.mu.Lock()
+	ctx, done, last := s.ctx, s.done, s.lastPoll
+	s.mu.Unlock()
+	if done == nil {
+		return nil, errNotConnected
+	}
+
+	if wait := time.Until(last.Add(s.config.PollInterval)); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+			return nil, errNotConnected
+		case <-timer.C:
+		}
+	}
+
+	s.mu.Lock()
+	s.lastPoll = time.Now()
+	s.mu.Unlock()
+
+	snapshot := hilinkSnapshot{Time: time.Now()}
+	if err := s.get(ctx, "/api/device/signal", &snapshot.Signal); err != nil {
+		return nil, err
+	}
+	if err := s.get(ctx, "/api/monitoring/status", &snapshot.Status); err != nil {
+		return nil, err
+	}
+	if err := s.get(ctx, "/api/monitoring/traffic-statistics", &snapshot.Traffic); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// WriteFrame is not supported: HiLink firmware has no AT channel
+func (s *hilinkSource) WriteFrame(data []byte) error {
+	return fmt.Errorf("%s: %w", s, errReadOnlySource)
+}
+
+func (s *hilinkSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// refreshSession fetches a new session cookie and request token
+func (s *hilinkSource) refreshSession(ctx context.Context) error {
+	var tok struct {
+		SesInfo string `xml:"SesInfo"`
+		TokInfo string `xml:"TokInfo"`
+	}
+	if err := s.fetch(ctx, "/api/webserver/SesTokInfo", &tok); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.session = tok.SesInfo
+	s.token = tok.TokInfo
+	s.mu.Unlock()
+	return nil
+}
+
+// get fetches an API document, renewing the session once if it has expired
+func (s *hilinkSource) get(ctx context.Context, path string, v interface{}) error {
+	err := s.fetch(ctx, path, v)
+	if apiErr, ok := err.(*hilinkError); ok &&
+		(apiErr.Code == hilinkErrTokenInvalid || apiErr.Code == hilinkErrSessionTimeout) {
+		s.logger.Printf("DEBUG: HiLink session expired (%d), renewing", apiErr.Code)
+		if err := s.refreshSession(ctx); err != nil {
+			return fmt.Errorf("failed to renew HiLink session: %v", err)
+		}
+		err = s.fetch(ctx, path, v)
+	}
+	if err != nil {
+		return fmt.Errorf("HiLink %s: %v", path, err)
+	}
+	return nil
+}
+
+func (s *hilinkSource) fetch(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(s.config.HiLinkURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.session != "" {
+		req.Header.Set("Cookie", s.session)
+	}
+	if s.token != "" {
+		req.Header.Set("__RequestVerificationToken", s.token)
+	}
+	s.mu.Unlock()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	// Errors come back as HTTP 200 with an <error> document
+	if bytes.Contains(body, []byte("<error>")) {
+		apiErr := &hilinkError{}
+		if err := xml.Unmarshal(body, apiErr); err != nil {
+			return fmt.Errorf("invalid error document: %v", err)
+		}
+		return apiErr
+	}
+
+	return xml.Unmarshal(body, v)
+}
+
+func (snapshot hilinkSnapshot) apply(w *WebSocketClient) {
+	networkType := hilinkNetworkTypesEx[snapshot.Status.CurrentNetworkTypeEx]
+	if networkType == "" {
+		networkType = hilinkNetworkTypes[snapshot.Status.CurrentNetworkType]
+	}
+
+	traffic := snapshot.Traffic
+	w.recordDataFlow(DataFlowRecord{
+		Timestamp: snapshot.Time,
+		Source:    "hilink",
+		Duration:  traffic.CurrentConnectTime,
+		ULBytes:   traffic.CurrentUpload,
+		DLBytes:   traffic.CurrentDownload,
+		ULRate:    traffic.CurrentUploadRate,
+		DLRate:    traffic.CurrentDownloadRate,
+		TotalUL:   traffic.TotalUpload,
+		TotalDL:   traffic.TotalDownload,
+	})
+
+	signal := snapshot.Signal
+	w.modemStatus.mu.Lock()
+	w.modemStatus.NetworkType = networkType
+	w.modemStatus.RSSI = hilinkLevel(signal.RSSI)
+	w.modemStatus.RSCP = hilinkLevel(signal.RSCP)
+	w.modemStatus.ECIO = hilinkLevel(signal.ECIO)
+	w.modemStatus.RSRP = hilinkLevel(signal.RSRP)
+	w.modemStatus.RSRQ = hilinkLevel(signal.RSRQ)
+	w.modemStatus.SINR = hilinkLevel(signal.SINR)
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+
+	if cell := hilinkCell(signal, networkType); cell.CellID != "" {
+		cell.apply(w)
+	}
+
+	w.logger.Printf("INFO: HiLink updated: %s, RSSI: %s, RSRP: %s, RSRQ: %s, SINR: %s",
+		networkType, signal.RSSI, signal.RSRP, signal.RSRQ, signal.SINR)
+}
+
+// hilinkLevel converts values such as "-95dBm", "-8.0dB" or ">=-51dBm",
+// returning nil when the value is missing
+func hilinkLevel(value string) *float64 {
+	value = strings.TrimLeft(value, "<>=")
+	value = strings.TrimSuffix(value, "dBm")
+	value = strings.TrimSuffix(value, "dB")
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// hilinkCell builds a serving cell report from the decimal cell_id and pci
+func hilinkCell(signal hilinkSignal, networkType string) CellReport {
+	r := CellReport{Command: "hilink"}
+	if ci, err := strconv.ParseInt(signal.CellID, 10, 64); err == nil {
+		r.CellID = strings.ToUpper(strconv.FormatInt(ci, 16))
+	}
+	if pci, err := strconv.Atoi(signal.PCI); err == nil {
+		r.PCI = &pci
+	}
+	if strings.HasPrefix(networkType, "LTE") {
+		r.RAT = "LTE"
+	} else if networkType != "" {
+		r.RAT = networkType
+	}
+	return r
+}
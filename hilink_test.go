@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeHiLink stands in for the web API of a HiLink stick. The first signal
+// request is answered with a session timeout to exercise the renewal.
+func fakeHiLink(t *testing.T) *httptest.Server {
+	sessions := 0
+	expired := true
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/webserver/SesTokInfo" {
+			sessions++
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<response><SesInfo>SessionID=s%d</SesInfo><TokInfo>token%d</TokInfo></response>`, sessions, sessions)
+			return
+		}
+
+		wantCookie, wantToken := fmt.Sprintf("SessionID=s%d", sessions), fmt.Sprintf("token%d", sessions)
+		if got := r.Header.Get("Cookie"); got != wantCookie {
+			t.Errorf("%s: Cookie = %q, want %q", r.URL.Path, got, wantCookie)
+		}
+		if got := r.Header.Get("__RequestVerificationToken"); got != wantToken {
+			t.Errorf("%s: token = %q, want %q", r.URL.Path, got, wantToken)
+		}
+
+		switch r.URL.Path {
+		case "/api/device/signal":
+			if expired {
+				expired = false
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><error><code>125003</code><message></message></error>`)
+				return
+			}
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<response><pci>371</pci><cell_id>26384898</cell_id><rssi>-67dBm</rssi><rsrp>-95dBm</rsrp>
+<rsrq>-8.0dB</rsrq><sinr>12dB</sinr><rscp></rscp><ecio></ecio><mode>7</mode></response>`)
+		case "/api/monitoring/status":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<response><ConnectionStatus>901</ConnectionStatus><CurrentNetworkType>19</CurrentNetworkType>
+<CurrentNetworkTypeEx>101</CurrentNetworkTypeEx></response>`)
+		case "/api/monitoring/traffic-statistics":
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<response><CurrentConnectTime>120</CurrentConnectTime><CurrentUpload>100</CurrentUpload>
+<CurrentDownload>200</CurrentDownload><CurrentUploadRate>10</CurrentUploadRate>
+<CurrentDownloadRate>50</CurrentDownloadRate><TotalUpload>1000</TotalUpload>
+<TotalDownload>2000</TotalDownload></response>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestHiLinkPolling(t *testing.T) {
+	server := fakeHiLink(t)
+	defer server.Close()
+
+	config := &Config{
+		Source:         "hilink",
+		HiLinkURL:      server.URL,
+		PollInterval:   time.Millisecond,
+		RequestTimeout: time.Second,
+	}
+	status := &ModemStatus{}
+	client, err := NewWebSocketClient(config, status, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.source.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.source.Close()
+
+	if err := client.readNext(); err != nil {
+		t.Fatal(err)
+	}
+
+	level := func(name string, got *float64, want float64) {
+		t.Helper()
+		if got == nil || *got != want {
+			t.Errorf("%s = %v, want %v", name, formatLevel(got), want)
+		}
+	}
+	if status.NetworkType != "LTE" {
+		t.Errorf("NetworkType = %q, want LTE", status.NetworkType)
+	}
+	level("RSSI", status.RSSI, -67)
+	level("RSRP", status.RSRP, -95)
+	level("RSRQ", status.RSRQ, -8)
+	level("SINR", status.SINR, 12)
+	if status.RSCP != nil || status.ECIO != nil {
+		t.Errorf("RSCP, ECIO = %v, %v, want absent", formatLevel(status.RSCP), formatLevel(status.ECIO))
+	}
+
+	if len(status.DataFlow) != 1 {
+		t.Fatalf("got %d data flow records, want 1", len(status.DataFlow))
+	}
+	flow := status.DataFlow[0]
+	if flow.ULBytes != 100 || flow.DLBytes != 200 || flow.DLRate != 50 || flow.TotalUL != 1000 || flow.TotalDL != 2000 {
+		t.Errorf("data flow = %+v", flow)
+	}
+
+	if status.Cell.CellID != "1929A02" {
+		t.Errorf("serving cell = %+v, want cell 1929A02", status.Cell)
+	}
+}
+
+func TestHiLinkHasNoATChannel(t *testing.T) {
+	source := newHiLinkSource(&Config{HiLinkURL: "http://192.168.8.1"}, log.New(io.Discard, "", 0))
+	if _, err := source.ReadFrame(); err == nil {
+		t.Error("ReadFrame() succeeded on a HiLink source")
+	}
+	if err := source.WriteFrame([]byte("AT\r")); err == nil {
+		t.Error("WriteFrame() succeeded on a HiLink source")
+	}
+}
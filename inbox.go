@@ -0,0 +1,177 @@
+package main
+
+import "net/http"
+
+func (s *Server) handleInbox(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(inboxHTML))
+}
+
+const inboxHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>SMS Inbox</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            min-height: 100vh;
+            padding: 20px;
+        }
+        .container { max-width: 900px; margin: 0 auto; }
+        .header { text-align: center; color: white; margin-bottom: 30px; }
+        .header h1 { font-size: 2.5rem; margin-bottom: 10px; text-shadow: 2px 2px 4px rgba(0,0,0,0.3); }
+        .header a { color: white; }
+        .header select { font-size: 1rem; padding: 6px 12px; border-radius: 8px; border: none; margin-top: 15px; }
+        .card {
+            background: white;
+            border-radius: 15px;
+            padding: 25px;
+            box-shadow: 0 10px 30px rgba(0,0,0,0.2);
+        }
+        .message { border-bottom: 1px solid #f0f0f0; padding: 12px 0; cursor: pointer; }
+        .message:last-child { border-bottom: none; }
+        .message .meta { display: flex; justify-content: space-between; color: #555; font-size: 0.9rem; }
+        .message .from { font-weight: 700; color: #333; }
+        .message .text { margin-top: 6px; color: #333; white-space: pre-wrap; word-break: break-word; }
+        .message.unread .from::before { content: "● "; color: #667eea; }
+        .message.collapsed .text { white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+        .message button {
+            margin-top: 8px;
+            padding: 4px 12px;
+            border: none;
+            border-radius: 6px;
+            background: #dc3545;
+            color: white;
+            cursor: pointer;
+        }
+        .empty { text-align: center; color: #666; font-style: italic; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📨 SMS Inbox</h1>
+            <p><a href="/">Back to dashboard</a></p>
+            <select id="modem-select" onchange="selectModem(this.value)"></select>
+        </div>
+        <div class="card" id="inbox">
+            <p class="empty">Loading...</p>
+        </div>
+    </div>
+
+    <script>
+        let currentModem = null;
+
+        function apiBase() {
+            return '/api/modems/' + encodeURIComponent(currentModem) + '/sms';
+        }
+
+        function loadModems() {
+            fetch('/api/modems')
+                .then(response => response.json())
+                .then(modems => {
+                    const select = document.getElementById('modem-select');
+                    select.innerHTML = '';
+                    modems.forEach(m => select.add(new Option(m.id, m.id)));
+                    select.style.display = modems.length > 1 ? '' : 'none';
+                    if (modems.length > 0) {
+                        selectModem(modems[0].id);
+                    }
+                })
+                .catch(error => console.error('Error fetching modems:', error));
+        }
+
+        function selectModem(id) {
+            currentModem = id;
+            loadInbox();
+        }
+
+        function loadInbox() {
+            if (!currentModem) return;
+            fetch(apiBase())
+                .then(response => response.json())
+                .then(renderInbox)
+                .catch(error => console.error('Error fetching messages:', error));
+        }
+
+        function renderInbox(messages) {
+            const inbox = document.getElementById('inbox');
+            inbox.innerHTML = '';
+            if (messages.length === 0) {
+                const empty = document.createElement('p');
+                empty.className = 'empty';
+                empty.textContent = 'No messages';
+                inbox.appendChild(empty);
+                return;
+            }
+            messages.forEach(msg => inbox.appendChild(renderMessage(msg)));
+        }
+
+        function renderMessage(msg) {
+            const div = document.createElement('div');
+            div.className = 'message collapsed' + (msg.read ? '' : ' unread');
+
+            const meta = document.createElement('div');
+            meta.className = 'meta';
+            const from = document.createElement('span');
+            from.className = 'from';
+            from.textContent = msg.from;
+            const info = document.createElement('span');
+            let when = new Date(msg.time).toLocaleString();
+            if (msg.parts > 1) {
+                when += ' · ' + msg.parts + ' parts' + (msg.complete ? '' : ', incomplete');
+            }
+            info.textContent = when;
+            meta.appendChild(from);
+            meta.appendChild(info);
+
+            const text = document.createElement('div');
+            text.className = 'text';
+            text.textContent = msg.text;
+
+            const del = document.createElement('button');
+            del.textContent = 'Delete';
+            del.style.display = 'none';
+            del.onclick = event => {
+                event.stopPropagation();
+                deleteMessage(msg.id);
+            };
+
+            div.appendChild(meta);
+            div.appendChild(text);
+            div.appendChild(del);
+            div.onclick = () => {
+                const open = div.classList.toggle('collapsed') === false;
+                del.style.display = open ? '' : 'none';
+                if (open && !msg.read) {
+                    fetch(apiBase() + '/' + msg.id)
+                        .then(() => { msg.read = true; div.classList.remove('unread'); })
+                        .catch(error => console.error('Error reading message:', error));
+                }
+            };
+            return div;
+        }
+
+        function deleteMessage(id) {
+            if (!confirm('Delete this message from the modem?')) return;
+            fetch(apiBase() + '/' + id, { method: 'DELETE' })
+                .then(response => {
+                    if (!response.ok) {
+                        return response.text().then(text => alert('Delete failed: ' + text));
+                    }
+                    loadInbox();
+                })
+                .catch(error => console.error('Error deleting message:', error));
+        }
+
+        loadModems();
+        setInterval(loadInbox, 10000);
+    </script>
+</body>
+</html>
+`
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Init states
+const (
+	initPending = "pending"
+	initRunning = "running"
+	initDone    = "done"
+	initFailed  = "failed"
+	initSkipped = "skipped"
+)
+
+// InitState reports how the initialization sequence of the current session went
+type InitState struct {
+	State    string     `json:"state"`
+	Step     int        `json:"step,omitempty"`
+	Command  string     `json:"command,omitempty"`
+	Attempts int        `json:"attempts,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Time     *time.Time `json:"time,omitempty"`
+}
+
+// initStep is one command of the initialization sequence. Besides a final OK
+// it may require a response line containing Expect.
+type initStep struct {
+	Command string
+	Expect  string
+}
+
+// initList collects repeated -init-command "AT...[|expected]" flags
+type initList []initStep
+
+func (l *initList) String() string {
+	commands := make([]string, 0, len(*l))
+	for _, step := range *l {
+		commands = append(commands, step.Command)
+	}
+	return strings.Join(commands, ",")
+}
+
+func (l *initList) Set(value string) error {
+	command, expect, _ := strings.Cut(value, "|")
+	command = strings.TrimSpace(command)
+	if !strings.HasPrefix(strings.ToUpper(command), "AT") {
+		return fmt.Errorf("invalid init command %q", value)
+	}
+	*l = append(*l, initStep{Command: command, Expect: strings.TrimSpace(expect)})
+	return nil
+}
+
+// InitState returns a snapshot of the initialization state
+func (w *WebSocketClient) InitState() InitState {
+	w.initMu.Lock()
+	defer w.initMu.Unlock()
+	return w.initState
+}
+
+func (w *WebSocketClient) setInitState(state InitState) {
+	now := time.Now()
+	state.Time = &now
+
+	w.initMu.Lock()
+	w.initState = state
+	w.initMu.Unlock()
+}
+
+// runInit sends the configured initialization commands, retrying each step
+// up to Config.InitRetries times. Sources without an AT channel skip it.
+func (w *WebSocketClient) runInit(ctx context.Context, done <-chan struct{}) error {
+	steps := w.config.InitCommands
+	if len(steps) == 0 {
+		w.setInitState(InitState{State: initDone})
+		return nil
+	}
+
+	for i, step := range steps {
+		state := InitState{State: initRunning, Step: i + 1, Command: step.Command}
+		var err error
+		for attempt := 1; attempt <= w.config.InitRetries+1; attempt++ {
+			state.Attempts = attempt
+			w.setInitState(state)
+
+			err = w.runInitStep(ctx, step)
+			if err == nil {
+				break
+			}
+			if errors.Is(err, errReadOnlySource) {
+				w.logger.Printf("INFO: Skipping init sequence: %v", err)
+				w.setInitState(InitState{State: initSkipped})
+				return nil
+			}
+			w.logger.Printf("WARN: Init step %d (%s) attempt %d failed: %v", i+1, step.Command, attempt, err)
+
+			timer := time.NewTimer(w.config.InitRetryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-done:
+				timer.Stop()
+				return errNotConnected
+			case <-timer.C:
+			}
+		}
+		if err != nil {
+			state.State = initFailed
+			state.Error = err.Error()
+			w.setInitState(state)
+			return fmt.Errorf("init step %d (%s) failed: %v", i+1, step.Command, err)
+		}
+	}
+
+	w.setInitState(InitState{State: initDone, Step: len(steps)})
+	w.logger.Printf("INFO: Init sequence completed (%d commands)", len(steps))
+	return nil
+}
+
+// runInitStep sends one command and checks its response
+func (w *WebSocketClient) runInitStep(ctx context.Context, step initStep) error {
+	lines, err := w.SendAT(ctx, step.Command)
+	if err != nil {
+		return err
+	}
+	if step.Expect == "" {
+		return nil
+	}
+	for _, line := range lines {
+		if strings.Contains(line, step.Expect) {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected %q in response %q", step.Expect, lines)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of recent round trips the stats cover
+const latencyWindow = 100
+
+// LatencyStats summarises ping/pong round-trip times to the modem bridge
+type LatencyStats struct {
+	Samples           int     `json:"samples"`
+	LastMs            float64 `json:"last_ms"`
+	MinMs             float64 `json:"min_ms"`
+	AvgMs             float64 `json:"avg_ms"`
+	MaxMs             float64 `json:"max_ms"`
+	P95Ms             float64 `json:"p95_ms"`
+	MissedPongs       int64   `json:"missed_pongs"`
+	ConsecutiveMissed int     `json:"consecutive_missed"`
+}
+
+// latencyReporter is implemented by sources that measure link latency
+type latencyReporter interface {
+	Latency() LatencyStats
+}
+
+// latencyTracker matches pongs to pings and keeps a window of round trips
+type latencyTracker struct {
+	mu          sync.Mutex
+	samples     []time.Duration // ring buffer of the last latencyWindow RTTs
+	next        int
+	last        time.Duration
+	seq         uint64
+	outstanding uint64 // sequence number awaiting a pong, 0 if none
+	sentAt      time.Time
+	missed      int64
+	consecutive int
+}
+
+// Ping registers a new ping and returns its payload. It also returns how many
+// pings in a row have now gone unanswered.
+func (t *latencyTracker) Ping(now time.Time) ([]byte, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.outstanding != 0 {
+		t.missed++
+		t.consecutive++
+	}
+
+	t.seq++
+	t.outstanding = t.seq
+	t.sentAt = now
+	return []byte(strconv.FormatUint(t.seq, 10)), t.consecutive
+}
+
+// Pong records the round trip for a pong payload
+func (t *latencyTracker) Pong(payload string, now time.Time) {
+	seq, err := strconv.ParseUint(payload, 10, 64)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A late pong for an older ping has already been counted as missed
+	if seq != t.outstanding {
+		return
+	}
+	t.outstanding = 0
+	t.consecutive = 0
+
+	rtt := now.Sub(t.sentAt)
+	t.last = rtt
+	if len(t.samples) < latencyWindow {
+		t.samples = append(t.samples, rtt)
+	} else {
+		t.samples[t.next] = rtt
+		t.next = (t.next + 1) % latencyWindow
+	}
+}
+
+// Reset forgets the ping in flight, e.g. after a reconnect
+func (t *latencyTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.outstanding = 0
+	t.consecutive = 0
+}
+
+// Stats returns a summary of the window
+func (t *latencyTracker) Stats() LatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := LatencyStats{
+		Samples:           len(t.samples),
+		LastMs:            durationMs(t.last),
+		MissedPongs:       t.missed,
+		ConsecutiveMissed: t.consecutive,
+	}
+	if len(t.samples) == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), t.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, rtt := range sorted {
+		total += rtt
+	}
+	p95 := (len(sorted)*95+99)/100 - 1
+
+	stats.MinMs = durationMs(sorted[0])
+	stats.MaxMs = durationMs(sorted[len(sorted)-1])
+	stats.AvgMs = durationMs(total / time.Duration(len(sorted)))
+	stats.P95Ms = durationMs(sorted[p95])
+	return stats
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -18,47 +18,88 @@ import (
 	"sync"
 	//"sync/atomic"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 // Config holds application configuration
 type Config struct {
-	ModemWSURL     string
-	WebPort        string
-	ReconnectDelay time.Duration
-	RequestTimeout time.Duration
-	PingInterval   time.Duration
-	MaxReconnect   int
-	LogLevel       string
-	BufferSize     int
+	Modems            modemList
+	Source            string
+	ModemWSURL        string
+	ModemCAFile       string
+	ModemCertFile     string
+	ModemKeyFile      string
+	ModemInsecure     bool
+	ModemHeaders      headerList `json:"-"`
+	ModemToken        string     `json:"-"`
+	ModemProxy        string     `json:"-"`
+	SerialDevice      string
+	SerialBaud        int
+	SerialMode        string
+	HiLinkURL         string
+	PollInterval      time.Duration
+	ActivePoll        bool
+	PollCommands      string
+	RecordFile        string
+	ReplayFile        string
+	ReplayModem       string
+	ReplaySpeed       float64
+	ReplayLoop        bool
+	WebPort           string
+	ReconnectDelay    time.Duration
+	ReconnectMaxDelay time.Duration
+	ReconnectCooldown time.Duration
+	ReconnectPolicy   string
+	RequestTimeout    time.Duration
+	PingInterval      time.Duration
+	MaxMissedPongs    int
+	ATTimeout         time.Duration
+	ATAllow           string
+	ATDeny            string
+	ATAuditLog        string
+	InitCommands      initList
+	InitRetries       int
+	InitRetryDelay    time.Duration
+	USSDPacked        bool
+	USSDQueries       ussdQueryList
+	MaxReconnect      int
+	LogLevel          string
+	BufferSize        int
 }
 
 // ModemStatus holds parsed modem status information
 type ModemStatus struct {
 	mu              sync.RWMutex
 	LastUpdate      time.Time        `json:"last_update"`
-	RSSI            int              `json:"rssi"`
 	NetworkType     string           `json:"network_type"`
-	SignalStrength  int              `json:"signal_strength"`
-	SignalQuality   int              `json:"signal_quality"`
-	RSRQ            int              `json:"rsrq"`
-	RSRP            int              `json:"rsrp"`
+	RSSI            *float64         `json:"rssi,omitempty"` // dBm
+	RSCP            *float64         `json:"rscp,omitempty"` // dBm
+	ECIO            *float64         `json:"ecio,omitempty"` // dB
+	RSRQ            *float64         `json:"rsrq,omitempty"` // dB
+	RSRP            *float64         `json:"rsrp,omitempty"` // dBm
+	SINR            *float64         `json:"sinr,omitempty"` // dB
+	Service         ServiceState     `json:"service"`
+	Operator        OperatorInfo     `json:"operator"`
+	Cell            ServingCell      `json:"cell"`
 	DataFlow        []DataFlowRecord `json:"data_flow"`
 	ConnectionStats ConnectionStats  `json:"connection_stats"`
 	IsConnected     bool             `json:"is_connected"`
 }
 
-// DataFlowRecord holds data flow information
+// DataFlowRecord holds data flow information. Rates are in bytes per
+// second, byte counts cover the current data session.
 type DataFlowRecord struct {
-	Timestamp time.Time `json:"timestamp"`
-	ReportID  string    `json:"report_id"`
-	ULBytes   int64     `json:"ul_bytes"`
-	DLBytes   int64     `json:"dl_bytes"`
-	ULRate    int64     `json:"ul_rate"`
-	DLRate    int64     `json:"dl_rate"`
-	TotalUL   int64     `json:"total_ul"`
-	TotalDL   int64     `json:"total_dl"`
+	Timestamp    time.Time `json:"timestamp"`
+	Source       string    `json:"source"`
+	Duration     int64     `json:"duration"` // seconds
+	ULBytes      int64     `json:"ul_bytes"`
+	DLBytes      int64     `json:"dl_bytes"`
+	ULRate       int64     `json:"ul_rate"`
+	DLRate       int64     `json:"dl_rate"`
+	RatesDerived bool      `json:"rates_derived,omitempty"`
+	QoSULRate    int64     `json:"qos_ul_rate,omitempty"`
+	QoSDLRate    int64     `json:"qos_dl_rate,omitempty"`
+	TotalUL      int64     `json:"total_ul,omitempty"`
+	TotalDL      int64     `json:"total_dl,omitempty"`
 }
 
 // ConnectionStats holds connection statistics
@@ -68,34 +109,68 @@ type ConnectionStats struct {
 	Uptime           time.Duration `json:"uptime"`
 	BytesReceived    int64         `json:"bytes_received"`
 	MessagesReceived int64         `json:"messages_received"`
+	Latency          *LatencyStats `json:"latency,omitempty"`
 }
 
-// WebSocketClient manages WebSocket connection
+// WebSocketClient manages the modem connection through a ModemSource
 type WebSocketClient struct {
-	config         *Config
-	modemStatus    *ModemStatus
-	conn           *websocket.Conn
-	shutdown       chan struct{}
-	reconnect      chan struct{}
-	stats          *ConnectionStats
-	logger         *log.Logger
-	reconnectCount int
-}
-
-// Server manages HTTP server and WebSocket client
-type Server struct {
 	config      *Config
 	modemStatus *ModemStatus
-	wsClient    *WebSocketClient
-	mux         *http.ServeMux
+	source      ModemSource
+	shutdown    chan struct{}
+	reconnect   chan struct{}
+	stats       *ConnectionStats // counters are atomic, statsMu guards the rest
+	statsMu     sync.Mutex
 	logger      *log.Logger
+	recorder    *frameRecorder
+	events      eventLog
+	cells       cellSurvey
+	sms         smsInbox
+	smsRef      uint32 // concatenation reference of the last message sent
+	ussd        *ussdState
+
+	reconnectMu    sync.Mutex // guards reconnectState
+	reconnectState ReconnectState
+	sessionStart   time.Time
+
+	cmdSlot   chan struct{} // held by the command in flight
+	pendingMu sync.Mutex    // guards pending
+	pending   *atCommand
+
+	framerMu   sync.Mutex // guards framer and flushTimer, orders line handling
+	framer     lineFramer
+	flushTimer *time.Timer
+	bootKey    string // last ^BOOT key
+	signalLost bool   // ^RSSILVL reported no signal
+
+	initMu    sync.Mutex // guards initState
+	initState InitState
+
+	parserStats map[string]*ParserStats // fixed keys, atomic counters
+
+	pollJobs  []pollJob
+	refreshMu sync.Mutex // guards refreshed
+	refreshed map[string]time.Time
+}
+
+// Server manages HTTP server and modem clients
+type Server struct {
+	config    *Config
+	modems    []*Modem
+	modemByID map[string]*Modem
+	mux       *http.ServeMux
+	logger    *log.Logger
+	atPolicy  *ATPolicy
+	atAudit   *atAuditor
 }
 
 // Regular expressions for parsing modem data
 var (
-	rssiRegex   = regexp.MustCompile(`\^RSSI:(-?\d+)`)
-	hcsqRegex   = regexp.MustCompile(`\^HCSQ:"([^"]+)",(\d+),(\d+),(\d+),(\d+)`)
-	dsflowRegex = regexp.MustCompile(`\^DSFLOWRPT:([^,]+),([^,]+),([^,]+),([^,]+),([^,]+),([^,]+),([^,]+)`)
+	rssiRegex      = regexp.MustCompile(`\^RSSI:\s*(-?\d+)`)
+	hcsqRegex      = regexp.MustCompile(`\^HCSQ:\s*"([^"]+)"((?:,\s*\d+)*)`)
+	dsflowRegex    = regexp.MustCompile(`\^DSFLOWRPT:\s*([^,]+),([^,]+),([^,]+),([^,]+),([^,]+),([^,]+),([^,]+)`)
+	csqRegex       = regexp.MustCompile(`\+CSQ:\s*(\d+),(\d+)`)
+	dsflowQryRegex = regexp.MustCompile(`\^DSFLOWQRY:\s*([^,]+),([^,]+),([^,]+),([^,]+),([^,]+),([^,]+)`)
 )
 
 func main() {
@@ -104,13 +179,21 @@ func main() {
 	// Setup logging
 	logger := setupLogger(config.LogLevel)
 
-	// Create modem status
-	modemStatus := &ModemStatus{
-		DataFlow: make([]DataFlowRecord, 0),
+	// Open capture file
+	capture, err := openCapture(config.RecordFile)
+	if err != nil {
+		logger.Fatalf("Failed to start recording: %v", err)
+	}
+	defer capture.Close()
+
+	// Create modems
+	modems, err := newModems(config, capture, logger)
+	if err != nil {
+		logger.Fatalf("Invalid modem configuration: %v", err)
 	}
 
 	// Create and start server
-	server := NewServer(config, modemStatus, logger)
+	server := NewServer(config, modems, logger)
 
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -129,18 +212,86 @@ func main() {
 func parseFlags() *Config {
 	config := &Config{}
 
+	flag.Var(&config.Modems, "modem",
+		"Modem to monitor as id=url (ws://, wss://, http://, serial:/dev/ttyUSBx[@baud], replay:file[#modem]); repeatable")
+	flag.StringVar(&config.Source, "source", "websocket",
+		"Modem source (websocket, serial, hilink, replay)")
 	flag.StringVar(&config.ModemWSURL, "modem-ws-url", "ws://localhost:8080/modem",
 		"Modem WebSocket URL")
+	flag.StringVar(&config.ModemCAFile, "modem-ca", "",
+		"PEM CA bundle for verifying a wss:// bridge")
+	flag.StringVar(&config.ModemCertFile, "modem-cert", "",
+		"PEM client certificate for a wss:// bridge")
+	flag.StringVar(&config.ModemKeyFile, "modem-key", "",
+		"PEM client key (default: read from -modem-cert)")
+	flag.BoolVar(&config.ModemInsecure, "modem-insecure", false,
+		"Skip TLS certificate verification of the bridge (lab use only)")
+	flag.Var(&config.ModemHeaders, "modem-header",
+		"Extra handshake header \"Name: value\"; value may be env:VAR or file:/path; repeatable")
+	flag.StringVar(&config.ModemToken, "modem-token", "",
+		"Bearer token for the bridge, literal or env:VAR or file:/path")
+	flag.StringVar(&config.ModemProxy, "modem-proxy", "",
+		"Proxy for the bridge: http://[user:pass@]host:port, socks5://[user:pass@]host:port (socks5h:// to resolve on the proxy) or env")
+	flag.StringVar(&config.SerialDevice, "serial-device", "/dev/ttyUSB0",
+		"Modem AT port device (serial source)")
+	flag.IntVar(&config.SerialBaud, "serial-baud", 115200,
+		"Serial baud rate")
+	flag.StringVar(&config.SerialMode, "serial-mode", "8N1",
+		"Serial data bits, parity and stop bits")
+	flag.StringVar(&config.HiLinkURL, "hilink-url", "http://192.168.8.1",
+		"HiLink web API base URL (hilink source)")
+	flag.DurationVar(&config.PollInterval, "poll-interval", 5*time.Second,
+		"HiLink API poll interval")
+	flag.BoolVar(&config.ActivePoll, "active-poll", true,
+		"Query metrics with AT commands when unsolicited reports stop arriving")
+	flag.StringVar(&config.PollCommands, "poll-commands", defaultPollCommands,
+		"Poll intervals as metric=interval or metric=off (hcsq, csq, dsflow, sysinfoex, cops, cereg, hfreqinfo, monsc, monnc)")
+	flag.StringVar(&config.RecordFile, "record", "",
+		"Append every received frame to this capture file")
+	flag.StringVar(&config.ReplayFile, "replay-file", "",
+		"Capture file to play back (replay source)")
+	flag.StringVar(&config.ReplayModem, "replay-modem", "",
+		"Modem id to play back from the capture (default: first one)")
+	flag.Float64Var(&config.ReplaySpeed, "replay-speed", 1,
+		"Replay speed factor (1 = real time, 0 = as fast as possible)")
+	flag.BoolVar(&config.ReplayLoop, "replay-loop", false,
+		"Restart the replay when the capture ends")
 	flag.StringVar(&config.WebPort, "web-port", "8080",
 		"Web dashboard port")
 	flag.DurationVar(&config.ReconnectDelay, "reconnect-delay", 5*time.Second,
-		"WebSocket reconnect delay")
+		"Initial modem reconnect delay, doubled on each failed attempt")
+	flag.DurationVar(&config.ReconnectMaxDelay, "reconnect-max-delay", 5*time.Minute,
+		"Upper bound for the modem reconnect delay")
+	flag.DurationVar(&config.ReconnectCooldown, "reconnect-cooldown", 2*time.Minute,
+		"Connection time after which the reconnect attempt count resets")
+	flag.StringVar(&config.ReconnectPolicy, "reconnect-policy", ReconnectForever,
+		"What to do when reconnects keep failing (forever, exit)")
 	flag.DurationVar(&config.RequestTimeout, "request-timeout", 10*time.Second,
 		"HTTP request timeout")
 	flag.DurationVar(&config.PingInterval, "ping-interval", 30*time.Second,
 		"WebSocket ping interval")
+	flag.IntVar(&config.MaxMissedPongs, "max-missed-pongs", 3,
+		"Reconnect after this many unanswered pings in a row (0 = never)")
+	flag.DurationVar(&config.ATTimeout, "at-timeout", 10*time.Second,
+		"Default timeout for AT commands")
+	flag.StringVar(&config.ATAllow, "at-allow", "",
+		"Comma-separated AT command prefixes allowed via /api/at (empty = all not denied)")
+	flag.StringVar(&config.ATDeny, "at-deny", defaultATDeny,
+		"Comma-separated AT command prefixes denied via /api/at")
+	flag.StringVar(&config.ATAuditLog, "at-audit-log", "",
+		"Append /api/at commands to this JSON lines file")
+	flag.Var(&config.InitCommands, "init-command",
+		"AT command to send on every connect, optionally \"AT...|expected response\"; repeatable, run in order (e.g. AT^CURC=1, AT+CEREG=2, AT+CNMI=2,1,0,2,0 for SMS notices)")
+	flag.IntVar(&config.InitRetries, "init-retries", 2,
+		"Retries per init command before the init sequence is reported as failed")
+	flag.DurationVar(&config.InitRetryDelay, "init-retry-delay", time.Second,
+		"Delay between init command retries")
+	flag.BoolVar(&config.USSDPacked, "ussd-packed", true,
+		"Send and expect USSD strings as packed GSM 7-bit hex, as Huawei modems do")
+	flag.Var(&config.USSDQueries, "ussd-query",
+		"USSD code to run on a schedule as \"name=code@interval[|regex]\", e.g. \"balance=*100#@24h\"; repeatable. The regex submatch, or the first number of the reply, is graphed")
 	flag.IntVar(&config.MaxReconnect, "max-reconnect", 10,
-		"Maximum reconnection attempts (0 = infinite)")
+		"Consecutive reconnection attempts before exiting with -reconnect-policy=exit (0 = infinite)")
 	flag.StringVar(&config.LogLevel, "log-level", "info",
 		"Log level (debug, info, warn, error)")
 	flag.IntVar(&config.BufferSize, "buffer-size", 100,
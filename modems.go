@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultModemID names the modem built from the top-level source flags when
+// no -modem entries are given
+const defaultModemID = "modem0"
+
+var modemIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Modem is one monitored modem with its own client, state and stats
+type Modem struct {
+	ID     string
+	Config *Config
+	Status *ModemStatus
+	Client *WebSocketClient
+}
+
+// modemSummary is the per-modem entry of /api/modems
+type modemSummary struct {
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	IsConnected     bool      `json:"is_connected"`
+	LastUpdate      time.Time `json:"last_update"`
+	NetworkType     string    `json:"network_type"`
+	Service         string    `json:"service,omitempty"`
+	Operator        string    `json:"operator,omitempty"`
+	Cell            string    `json:"cell,omitempty"`
+	Roaming         bool      `json:"roaming"`
+	RSSI            *float64  `json:"rssi,omitempty"`
+	RSCP            *float64  `json:"rscp,omitempty"`
+	ECIO            *float64  `json:"ecio,omitempty"`
+	RSRP            *float64  `json:"rsrp,omitempty"`
+	RSRQ            *float64  `json:"rsrq,omitempty"`
+	SINR            *float64  `json:"sinr,omitempty"`
+	TotalReconnects int64     `json:"total_reconnects"`
+}
+
+// modemList collects repeated -modem id=spec flags
+type modemList []string
+
+func (m *modemList) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *modemList) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+// newModems builds one Modem per -modem entry, or a single modem from the
+// top-level flags when there are none
+func newModems(config *Config, capture *captureFile, logger *log.Logger) ([]*Modem, error) {
+	specs := []string(config.Modems)
+	if len(specs) == 0 {
+		specs = []string{defaultModemID + "="}
+	}
+
+	modems := make([]*Modem, 0, len(specs))
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		id, modemConfig, err := parseModemSpec(config, spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate modem id %q", id)
+		}
+		seen[id] = true
+
+		modemLogger := log.New(logger.Writer(), "["+id+"] ", logger.Flags()|log.Lmsgprefix)
+		status := &ModemStatus{
+			DataFlow: make([]DataFlowRecord, 0),
+		}
+		client, err := NewWebSocketClient(modemConfig, status, modemLogger)
+		if err != nil {
+			return nil, fmt.Errorf("modem %s: %v", id, err)
+		}
+		client.recorder = newFrameRecorder(capture, id, modemLogger)
+
+		modems = append(modems, &Modem{
+			ID:     id,
+			Config: modemConfig,
+			Status: status,
+			Client: client,
+		})
+	}
+	return modems, nil
+}
+
+// parseModemSpec returns a copy of base configured for an "id=spec" entry.
+// The transport is chosen from the spec:
+//
+//	ws://..., wss://...          websocket bridge
+//	http://..., https://...      HiLink web API
+//	serial:/dev/ttyUSB2[@baud]   serial AT port
+//	replay:capture.jsonl[#id]    recorded capture
+//
+// An empty spec keeps the source configured by the top-level flags.
+func parseModemSpec(base *Config, spec string) (string, *Config, error) {
+	id, target, ok := strings.Cut(spec, "=")
+	if !ok || !modemIDRegex.MatchString(id) {
+		return "", nil, fmt.Errorf("invalid modem %q (want id=url)", spec)
+	}
+
+	config := *base
+	config.Modems = nil
+
+	switch {
+	case target == "":
+	case strings.HasPrefix(target, "ws://"), strings.HasPrefix(target, "wss://"):
+		config.Source = "websocket"
+		config.ModemWSURL = target
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		config.Source = "hilink"
+		config.HiLinkURL = target
+	case strings.HasPrefix(target, "serial:"):
+		config.Source = "serial"
+		device, baud, hasBaud := strings.Cut(strings.TrimPrefix(target, "serial:"), "@")
+		config.SerialDevice = device
+		if hasBaud {
+			rate, err := strconv.Atoi(baud)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid baud rate in modem %q", spec)
+			}
+			config.SerialBaud = rate
+		}
+	case strings.HasPrefix(target, "replay:"):
+		config.Source = "replay"
+		file, modem, _ := strings.Cut(strings.TrimPrefix(target, "replay:"), "#")
+		config.ReplayFile = file
+		config.ReplayModem = modem
+	default:
+		return "", nil, fmt.Errorf("unsupported modem source in %q", spec)
+	}
+
+	return id, &config, nil
+}
+
+// Summary returns the overview shown in /api/modems
+func (m *Modem) Summary() modemSummary {
+	m.Status.mu.RLock()
+	defer m.Status.mu.RUnlock()
+
+	return modemSummary{
+		ID:              m.ID,
+		Source:          m.Client.source.String(),
+		IsConnected:     m.Status.IsConnected,
+		LastUpdate:      m.Status.LastUpdate,
+		NetworkType:     m.Status.NetworkType,
+		Service:         m.Status.Service.Status,
+		Roaming:         m.Status.Service.Roaming,
+		Operator:        m.Status.Operator.Name,
+		Cell:            m.Status.Cell.describe(),
+		RSSI:            m.Status.RSSI,
+		RSCP:            m.Status.RSCP,
+		ECIO:            m.Status.ECIO,
+		RSRP:            m.Status.RSRP,
+		RSRQ:            m.Status.RSRQ,
+		SINR:            m.Status.SINR,
+		TotalReconnects: atomic.LoadInt64(&m.Client.stats.TotalReconnects),
+	}
+}
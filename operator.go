@@ -0,0 +1,185 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OperatorInfo is the network the modem is registered on, from +COPS
+type OperatorInfo struct {
+	Mode       string    `json:"mode"`
+	PLMN       string    `json:"plmn,omitempty"`
+	MCC        string    `json:"mcc,omitempty"`
+	MNC        string    `json:"mnc,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Technology string    `json:"technology,omitempty"`
+	LastUpdate time.Time `json:"last_update"`
+}
+
+//go:embed mccmnc.csv
+var mccmncCSV string
+
+// mccmncTable resolves a PLMN (MCC followed by MNC) to its operator, and
+// mccCountries an MCC to its country
+var (
+	mccmncTable  = map[string]mccmncEntry{}
+	mccCountries = map[string]string{}
+)
+
+type mccmncEntry struct {
+	MCC      string
+	MNC      string
+	Country  string
+	Operator string
+}
+
+// copsModes names the +COPS <mode>
+var copsModes = map[int]string{
+	0: "automatic",
+	1: "manual",
+	2: "deregistered",
+	3: "format only",
+	4: "manual/automatic",
+}
+
+// copsAccessTechnologies names the +COPS <AcT>
+var copsAccessTechnologies = map[int]string{
+	0: "GSM",
+	1: "GSM Compact",
+	2: "UTRAN",
+	3: "GSM w/EGPRS",
+	4: "UTRAN w/HSDPA",
+	5: "UTRAN w/HSUPA",
+	6: "UTRAN w/HSDPA and HSUPA",
+	7: "E-UTRAN",
+}
+
+// copsRegex matches +COPS: <mode>[,<format>,"<oper>"[,<AcT>]]
+var copsRegex = regexp.MustCompile(`\+COPS:\s*(\d+)(?:,(\d+),"([^"]*)"(?:,(\d+))?)?\s*$`)
+
+func init() {
+	records, err := csv.NewReader(strings.NewReader(mccmncCSV)).ReadAll()
+	if err != nil {
+		panic("invalid mccmnc.csv: " + err.Error())
+	}
+	for _, record := range records[1:] {
+		entry := mccmncEntry{MCC: record[0], MNC: record[1], Country: record[2], Operator: record[3]}
+		mccmncTable[entry.MCC+entry.MNC] = entry
+		mccCountries[entry.MCC] = entry.Country
+	}
+
+	registerURCParser("+COPS:", parseCOPS)
+}
+
+// OperatorReport is a +COPS read response
+type OperatorReport struct {
+	Operator OperatorInfo
+}
+
+func parseCOPS(line string) (urcResult, error) {
+	// The AT+COPS=? scan lists networks in parentheses; it is not the
+	// current registration
+	if strings.Contains(line, "(") {
+		return ignoredResult{}, nil
+	}
+
+	m := copsRegex.FindStringSubmatch(line)
+	if len(m) != 5 {
+		return nil, fmt.Errorf("malformed +COPS: %q", line)
+	}
+
+	op := OperatorInfo{Mode: codeName(copsModes, m[1])}
+	if m[4] != "" {
+		op.Technology = codeName(copsAccessTechnologies, m[4])
+	}
+
+	switch m[2] {
+	case "":
+		// Not registered
+	case "2":
+		op.PLMN = m[3]
+		if len(op.PLMN) < 5 {
+			return nil, fmt.Errorf("invalid PLMN in +COPS: %q", line)
+		}
+		op.MCC, op.MNC = op.PLMN[:3], op.PLMN[3:]
+		op.Country = mccCountries[op.MCC]
+		if entry, ok := mccmncTable[op.PLMN]; ok {
+			op.Name = entry.Operator
+		}
+	default:
+		// Long or short alphanumeric name as reported by the network
+		op.Name = m[3]
+	}
+	return OperatorReport{Operator: op}, nil
+}
+
+// identity is what an operator change is detected on
+func (op OperatorInfo) identity() string {
+	if op.PLMN != "" {
+		return op.PLMN
+	}
+	return op.Name
+}
+
+// sameOperator reports whether two registrations are on the same network.
+// A numeric and an alphanumeric report cannot be compared and count as same.
+func sameOperator(a, b OperatorInfo) bool {
+	switch {
+	case a.PLMN != "" && b.PLMN != "":
+		return a.PLMN == b.PLMN
+	case a.identity() == "" || b.identity() == "":
+		return a.identity() == b.identity()
+	case a.PLMN == "" && b.PLMN == "":
+		return strings.EqualFold(a.Name, b.Name)
+	default:
+		return true
+	}
+}
+
+func (op OperatorInfo) String() string {
+	switch {
+	case op.identity() == "":
+		return "none"
+	case op.PLMN != "" && op.Name != "":
+		return op.Name + " (" + op.PLMN + ")"
+	default:
+		return op.identity()
+	}
+}
+
+func (r OperatorReport) apply(w *WebSocketClient) {
+	op := r.Operator
+	op.LastUpdate = time.Now()
+
+	w.modemStatus.mu.Lock()
+	prev := w.modemStatus.Operator
+	// Keep what the other format told us while the network is unchanged
+	if op.PLMN == "" && op.Name != "" && prev.Name == op.Name {
+		op.PLMN, op.MCC, op.MNC, op.Country = prev.PLMN, prev.MCC, prev.MNC, prev.Country
+	}
+	w.modemStatus.Operator = op
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+	w.markRefreshed("cops")
+
+	if !sameOperator(prev, op) {
+		w.recordEvent(eventOperatorChange, fmt.Sprintf("Operator changed from %s to %s", prev, op),
+			map[string]string{
+				"from":       prev.identity(),
+				"to":         op.identity(),
+				"name":       op.Name,
+				"country":    op.Country,
+				"technology": op.Technology,
+			})
+	}
+}
+
+// ignoredResult is returned for lines that carry nothing to apply
+type ignoredResult struct{}
+
+func (ignoredResult) apply(w *WebSocketClient) {}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestParseCOPS(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    OperatorInfo
+		wantErr bool
+	}{
+		{
+			line: `+COPS: 0,2,"26201",7`,
+			want: OperatorInfo{Mode: "automatic", PLMN: "26201", MCC: "262", MNC: "01", Name: "Telekom", Country: "Germany", Technology: "E-UTRAN"},
+		},
+		{
+			line: `+COPS: 1,2,"310260",2`,
+			want: OperatorInfo{Mode: "manual", PLMN: "310260", MCC: "310", MNC: "260", Name: "T-Mobile", Country: "United States", Technology: "UTRAN"},
+		},
+		{
+			line: `+COPS: 0,2,"26299",7`,
+			want: OperatorInfo{Mode: "automatic", PLMN: "26299", MCC: "262", MNC: "99", Country: "Germany", Technology: "E-UTRAN"},
+		},
+		{
+			line: `+COPS: 0,2,"99999"`,
+			want: OperatorInfo{Mode: "automatic", PLMN: "99999", MCC: "999", MNC: "99"},
+		},
+		{
+			line: `+COPS: 0,0,"MTS RUS",7`,
+			want: OperatorInfo{Mode: "automatic", Name: "MTS RUS", Technology: "E-UTRAN"},
+		},
+		{
+			line: `+COPS: 0,1,"MTS",0`,
+			want: OperatorInfo{Mode: "automatic", Name: "MTS", Technology: "GSM"},
+		},
+		{line: `+COPS: 0`, want: OperatorInfo{Mode: "automatic"}},
+		{line: `+COPS: 2`, want: OperatorInfo{Mode: "deregistered"}},
+		{line: `+COPS: 0,2,"2620",7`, wantErr: true},
+		{line: `+COPS: 0,2,26201,7`, wantErr: true},
+		{line: `+COPS:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		result, err := parseCOPS(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCOPS(%q) = %+v, want an error", tt.line, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCOPS(%q): %v", tt.line, err)
+			continue
+		}
+		if got := result.(OperatorReport).Operator; got != tt.want {
+			t.Errorf("parseCOPS(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseCOPSIgnoresScan(t *testing.T) {
+	result, err := parseCOPS(`+COPS: (2,"Telekom.de","TDG","26201",7),(1,"Vodafone.de","Vodafone","26202",7),,(0,1,2,3,4),(0,1,2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.(ignoredResult); !ok {
+		t.Errorf("parseCOPS(scan) = %T, want ignoredResult", result)
+	}
+}
+
+func TestSameOperator(t *testing.T) {
+	telekom := OperatorInfo{PLMN: "26201", Name: "Telekom"}
+	tests := []struct {
+		a, b OperatorInfo
+		want bool
+	}{
+		{telekom, OperatorInfo{PLMN: "26201"}, true},
+		{telekom, OperatorInfo{PLMN: "26202", Name: "Vodafone"}, false},
+		{OperatorInfo{Name: "MTS RUS"}, OperatorInfo{Name: "mts rus"}, true},
+		{OperatorInfo{Name: "MTS RUS"}, OperatorInfo{Name: "Beeline"}, false},
+		{OperatorInfo{}, OperatorInfo{}, true},
+		{OperatorInfo{}, telekom, false},
+		{telekom, OperatorInfo{Name: "Telekom.de"}, true},
+	}
+	for _, tt := range tests {
+		if got := sameOperator(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameOperator(%v, %v) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// gsm7Alphabet is the GSM 03.38 default alphabet indexed by septet
+var gsm7Alphabet = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+// gsm7Extension is the GSM 03.38 extension table, reached through the 0x1B
+// escape septet
+var gsm7Extension = map[byte]rune{
+	0x0A: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2F: '\\',
+	0x3C: '[', 0x3D: '~', 0x3E: ']', 0x40: '|', 0x65: '€',
+}
+
+// gsm7Escape introduces a septet of the extension table
+const gsm7Escape = 0x1B
+
+// SMS data coding alphabets
+const (
+	smsGSM7 = "gsm7"
+	sms8Bit = "8bit"
+	smsUCS2 = "ucs2"
+)
+
+// smsDeliver is a decoded SMS-DELIVER TPDU
+type smsDeliver struct {
+	SMSC     string
+	From     string
+	Time     time.Time
+	Encoding string
+	Text     string
+	// Concatenation from the user data header; Parts is 0 for a single message
+	Ref   int
+	Parts int
+	Seq   int
+}
+
+// pduReader walks the octets of a PDU
+type pduReader struct {
+	data []byte
+	pos  int
+}
+
+var errShortPDU = errors.New("PDU too short")
+
+func (r *pduReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errShortPDU
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *pduReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errShortPDU
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// decodeDeliverPDU decodes a hex SMS-DELIVER PDU as returned by +CMGR,
+// +CMGL and +CMT in PDU mode, starting with the SMSC address
+func decodeDeliverPDU(pdu string) (*smsDeliver, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(pdu))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PDU: %v", err)
+	}
+	msg, err := decodeDeliver(&pduReader{data: data})
+	if err != nil {
+		return nil, fmt.Errorf("invalid PDU: %w", err)
+	}
+	return msg, nil
+}
+
+func decodeDeliver(r *pduReader) (*smsDeliver, error) {
+	msg := &smsDeliver{}
+
+	smscLen, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if smscLen > 0 {
+		smsc, err := r.bytes(int(smscLen))
+		if err != nil {
+			return nil, err
+		}
+		msg.SMSC = decodeAddress(smsc[0], smsc[1:], (int(smscLen)-1)*2)
+	}
+
+	first, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if first&0x03 != 0 {
+		return nil, fmt.Errorf("not an SMS-DELIVER (message type %d)", first&0x03)
+	}
+	hasUDH := first&0x40 != 0
+
+	digits, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	toa, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := r.bytes((int(digits) + 1) / 2)
+	if err != nil {
+		return nil, err
+	}
+	msg.From = decodeAddress(toa, addr, int(digits))
+
+	if _, err := r.byte(); err != nil { // TP-PID
+		return nil, err
+	}
+	dcs, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Encoding, err = smsAlphabet(dcs); err != nil {
+		return nil, err
+	}
+
+	scts, err := r.bytes(7)
+	if err != nil {
+		return nil, err
+	}
+	msg.Time = decodeSCTS(scts)
+
+	udl, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	ud := r.data[r.pos:]
+	if err := msg.decodeUserData(ud, int(udl), hasUDH); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// decodeUserData extracts the concatenation header and the text. UDL counts
+// septets for GSM 7-bit and octets otherwise, header included.
+func (msg *smsDeliver) decodeUserData(ud []byte, udl int, hasUDH bool) error {
+	headerLen := 0
+	if hasUDH {
+		if len(ud) == 0 {
+			return errShortPDU
+		}
+		headerLen = int(ud[0]) + 1
+		if headerLen > len(ud) {
+			return errShortPDU
+		}
+		msg.parseUDH(ud[1:headerLen])
+	}
+
+	switch msg.Encoding {
+	case smsGSM7:
+		// The text starts at the first septet boundary after the header
+		skip := (headerLen*8 + 6) / 7
+		septets := unpackSeptets(ud, udl)
+		if len(septets) < udl || skip > udl {
+			return errShortPDU
+		}
+		msg.Text = decodeGSM7(septets[skip:])
+	case smsUCS2:
+		if udl > len(ud) || headerLen > udl {
+			return errShortPDU
+		}
+		msg.Text = decodeUCS2(ud[headerLen:udl])
+	default:
+		if udl > len(ud) || headerLen > udl {
+			return errShortPDU
+		}
+		msg.Text = hex.EncodeToString(ud[headerLen:udl])
+	}
+	return nil
+}
+
+// parseUDH picks the concatenation information elements out of a user data
+// header; other elements, and concatenation with an impossible sequence
+// number, are skipped
+func (msg *smsDeliver) parseUDH(udh []byte) {
+	for i := 0; i+1 < len(udh); {
+		iei, length := udh[i], int(udh[i+1])
+		data := udh[i+2:]
+		if length > len(data) {
+			return
+		}
+		data = data[:length]
+		switch {
+		case iei == 0x00 && length == 3:
+			msg.Ref, msg.Parts, msg.Seq = int(data[0]), int(data[1]), int(data[2])
+		case iei == 0x08 && length == 4:
+			msg.Ref, msg.Parts, msg.Seq = int(data[0])<<8|int(data[1]), int(data[2]), int(data[3])
+		}
+		i += 2 + length
+	}
+	if msg.Seq < 1 || msg.Seq > msg.Parts {
+		msg.Ref, msg.Parts, msg.Seq = 0, 0, 0
+	}
+}
+
+// smsAlphabet maps a data coding scheme to its alphabet
+func smsAlphabet(dcs byte) (string, error) {
+	switch {
+	case dcs&0xC0 == 0x00, dcs&0xC0 == 0x40:
+		// General data coding, possibly marked for automatic deletion
+		if dcs&0x20 != 0 {
+			return "", fmt.Errorf("compressed data coding 0x%02X not supported", dcs)
+		}
+		switch (dcs >> 2) & 0x03 {
+		case 0x00:
+			return smsGSM7, nil
+		case 0x01:
+			return sms8Bit, nil
+		case 0x02:
+			return smsUCS2, nil
+		}
+		return "", fmt.Errorf("reserved data coding 0x%02X", dcs)
+	case dcs&0xF0 == 0xC0, dcs&0xF0 == 0xD0:
+		// Message waiting indication, discard or store
+		return smsGSM7, nil
+	case dcs&0xF0 == 0xE0:
+		return smsUCS2, nil
+	case dcs&0xF0 == 0xF0:
+		if dcs&0x04 != 0 {
+			return sms8Bit, nil
+		}
+		return smsGSM7, nil
+	}
+	return "", fmt.Errorf("reserved data coding 0x%02X", dcs)
+}
+
+// decodeAddress decodes a semi-octet or alphanumeric address field
+func decodeAddress(toa byte, data []byte, digits int) string {
+	if toa&0x70 == 0x50 {
+		// Alphanumeric sender such as an operator name, packed GSM 7-bit
+		return decodeGSM7(unpackSeptets(data, digits*4/7))
+	}
+
+	var b strings.Builder
+	if toa&0x70 == 0x10 {
+		b.WriteByte('+')
+	}
+	const semiOctets = "0123456789*#abc"
+	for i := 0; i < digits && i/2 < len(data); i++ {
+		nibble := data[i/2] & 0x0F
+		if i%2 == 1 {
+			nibble = data[i/2] >> 4
+		}
+		if nibble == 0x0F {
+			break
+		}
+		b.WriteByte(semiOctets[nibble])
+	}
+	return b.String()
+}
+
+// swapped decodes a semi-octet with its digits swapped
+func swapped(b byte) int {
+	return int(b&0x0F)*10 + int(b>>4)
+}
+
+// decodeSCTS decodes the service centre time stamp
+func decodeSCTS(scts []byte) time.Time {
+	// The time zone is in quarter hours, its sign in bit 3 of the tens digit
+	quarters := int(scts[6]&0x07)*10 + int(scts[6]>>4)
+	if scts[6]&0x08 != 0 {
+		quarters = -quarters
+	}
+	zone := time.FixedZone("", quarters*15*60)
+	return time.Date(2000+swapped(scts[0]), time.Month(swapped(scts[1])), swapped(scts[2]),
+		swapped(scts[3]), swapped(scts[4]), swapped(scts[5]), 0, zone)
+}
+
+// unpackSeptets unpacks up to n 7-bit characters packed LSB first
+func unpackSeptets(data []byte, n int) []byte {
+	septets := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		bit := i * 7
+		if bit/8 >= len(data) {
+			break
+		}
+		v := uint16(data[bit/8])
+		if bit/8+1 < len(data) {
+			v |= uint16(data[bit/8+1]) << 8
+		}
+		septets = append(septets, byte(v>>(bit%8))&0x7F)
+	}
+	return septets
+}
+
+// decodeGSM7 maps septets to text through the default alphabet and its
+// extension table
+func decodeGSM7(septets []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(septets); i++ {
+		c := septets[i]
+		if c == gsm7Escape && i+1 < len(septets) {
+			i++
+			if r, ok := gsm7Extension[septets[i]]; ok {
+				b.WriteRune(r)
+			} else {
+				// Unknown extensions fall back to the default alphabet
+				b.WriteRune(gsm7Alphabet[septets[i]])
+			}
+			continue
+		}
+		b.WriteRune(gsm7Alphabet[c])
+	}
+	return b.String()
+}
+
+// decodeUCS2 decodes big-endian UTF-16, including surrogate pairs
+func decodeUCS2(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// SMS user data limits: septets or UTF-16 units per single message, and per
+// part once a 6-octet concatenation header is added
+const (
+	gsm7SingleSeptets = 160
+	gsm7PartSeptets   = 153
+	ucs2SingleUnits   = 70
+	ucs2PartUnits     = 67
+)
+
+// gsm7Reverse maps a rune to its septets, two for the extension table
+var gsm7Reverse = func() map[rune][]byte {
+	reverse := make(map[rune][]byte, len(gsm7Alphabet)+len(gsm7Extension))
+	for i, r := range gsm7Alphabet {
+		if i != gsm7Escape {
+			reverse[r] = []byte{byte(i)}
+		}
+	}
+	for septet, r := range gsm7Extension {
+		reverse[r] = []byte{gsm7Escape, septet}
+	}
+	return reverse
+}()
+
+// smsSubmitPart is the user data of one part of an outgoing message
+type smsSubmitPart struct {
+	units []byte // septets for GSM 7-bit, UTF-16BE octets for UCS2
+	count int    // septets or UTF-16 units, for the length checks
+}
+
+// splitSMS encodes text in GSM 7-bit when every character is in the
+// default alphabet or its extension, UCS2 otherwise, and splits it into
+// the parts of a concatenated message when it does not fit in one
+func splitSMS(text string) (string, []smsSubmitPart) {
+	encoding := smsGSM7
+	var chars [][]byte // encoded characters, never split across parts
+	for _, r := range text {
+		septets, ok := gsm7Reverse[r]
+		if !ok {
+			encoding = smsUCS2
+			break
+		}
+		chars = append(chars, septets)
+	}
+
+	single, part := gsm7SingleSeptets, gsm7PartSeptets
+	if encoding == smsUCS2 {
+		single, part = ucs2SingleUnits, ucs2PartUnits
+		chars = chars[:0]
+		for _, r := range text {
+			var units []byte
+			for _, u := range utf16.Encode([]rune{r}) {
+				units = append(units, byte(u>>8), byte(u))
+			}
+			chars = append(chars, units)
+		}
+	}
+
+	width := func(c []byte) int {
+		if encoding == smsUCS2 {
+			return len(c) / 2
+		}
+		return len(c)
+	}
+	total := 0
+	for _, c := range chars {
+		total += width(c)
+	}
+	limit := part
+	if total <= single {
+		limit = single
+	}
+
+	var parts []smsSubmitPart
+	current := smsSubmitPart{}
+	for _, c := range chars {
+		if current.count+width(c) > limit {
+			parts = append(parts, current)
+			current = smsSubmitPart{}
+		}
+		current.units = append(current.units, c...)
+		current.count += width(c)
+	}
+	return encoding, append(parts, current)
+}
+
+// encodeSubmitPDU builds a hex SMS-SUBMIT PDU using the SMSC stored in the
+// modem. ref, seq and total describe the concatenation; total 1 sends a
+// single message. It also returns the TPDU length AT+CMGS expects.
+func encodeSubmitPDU(to, encoding string, part smsSubmitPart, ref, seq, total int) (string, int, error) {
+	number := strings.TrimPrefix(to, "+")
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return "", 0, fmt.Errorf("invalid destination %q", to)
+	}
+
+	first := byte(0x01) // SMS-SUBMIT, no validity period
+	var udh []byte
+	if total > 1 {
+		first |= 0x40
+		udh = []byte{0x05, 0x00, 0x03, byte(ref), byte(total), byte(seq)}
+	}
+
+	toa := byte(0x81)
+	if strings.HasPrefix(to, "+") {
+		toa = 0x91
+	}
+	tpdu := []byte{first, 0x00, byte(len(number)), toa}
+	for i := 0; i < len(number); i += 2 {
+		lo, hi := number[i]-'0', byte(0x0F)
+		if i+1 < len(number) {
+			hi = number[i+1] - '0'
+		}
+		tpdu = append(tpdu, hi<<4|lo)
+	}
+
+	var ud []byte
+	var udl int
+	if encoding == smsUCS2 {
+		tpdu = append(tpdu, 0x00, 0x08)
+		ud = append(udh, part.units...)
+		udl = len(ud)
+	} else {
+		tpdu = append(tpdu, 0x00, 0x00)
+		// Pad the header to a septet boundary so the text starts on one
+		headerSeptets := (len(udh)*8 + 6) / 7
+		fill := headerSeptets*7 - len(udh)*8
+		ud = append(udh, packSeptets(part.units, fill)...)
+		udl = headerSeptets + len(part.units)
+	}
+	tpdu = append(tpdu, byte(udl))
+	tpdu = append(tpdu, ud...)
+
+	// "00": no SMSC address, use the one configured in the modem
+	return "00" + strings.ToUpper(hex.EncodeToString(tpdu)), len(tpdu), nil
+}
+
+// packSeptets packs 7-bit characters LSB first after fill padding bits
+func packSeptets(septets []byte, fill int) []byte {
+	var packed []byte
+	var acc uint32
+	bits := fill
+	for _, s := range septets {
+		acc |= uint32(s&0x7F) << bits
+		bits += 7
+		for bits >= 8 {
+			packed = append(packed, byte(acc))
+			acc >>= 8
+			bits -= 8
+		}
+	}
+	if bits > 0 {
+		packed = append(packed, byte(acc))
+	}
+	return packed
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// deliverFrom is the originating address +4915112345678 and the protocol
+// identifier of the test PDUs, which have no SMSC address
+const deliverFrom = "0D91945111325476F800"
+
+// deliverSCTS is 2025-01-13 14:00:00 +01:00
+const deliverSCTS = "52103141000040"
+
+func TestDecodeDeliverPDU(t *testing.T) {
+	tests := []struct {
+		name     string
+		pdu      string
+		from     string
+		text     string
+		encoding string
+		ref      int
+		parts    int
+		seq      int
+	}{
+		{
+			name:     "GSM 7-bit with SMSC",
+			pdu:      "07911326040000F0040B911346610089F60000208062917314080CC8F71D14969741F977FD07",
+			from:     "+31641600986",
+			text:     "How are you?",
+			encoding: smsGSM7,
+		},
+		{
+			name:     "concatenated, 8-bit reference",
+			pdu:      "0044" + deliverFrom + "00" + deliverSCTS + "0D050003420201906536FB0D02",
+			from:     "+4915112345678",
+			text:     "Hello ",
+			encoding: smsGSM7,
+			ref:      0x42, parts: 2, seq: 1,
+		},
+		{
+			name:     "concatenated, 16-bit reference",
+			pdu:      "0044" + deliverFrom + "00" + deliverSCTS + "0A060804ABCD0201C834",
+			from:     "+4915112345678",
+			text:     "Hi",
+			encoding: smsGSM7,
+			ref:      0xABCD, parts: 2, seq: 1,
+		},
+		{
+			name:     "concatenation with an impossible sequence number",
+			pdu:      "0044" + deliverFrom + "00" + deliverSCTS + "0D050003420203906536FB0D02",
+			from:     "+4915112345678",
+			text:     "Hello ",
+			encoding: smsGSM7,
+		},
+		{
+			name:     "UCS2 with a surrogate pair",
+			pdu:      "0004" + deliverFrom + "08" + deliverSCTS + "12041F044004380432043504420020D83DDE00",
+			from:     "+4915112345678",
+			text:     "Привет 😀",
+			encoding: smsUCS2,
+		},
+		{
+			name:     "alphanumeric sender and extension table",
+			pdu:      "00040ED0D637396C7EBBCB0000521031410000400B5076D80DDAA0DEEB4D0A",
+			from:     "Vodafone",
+			text:     "Plan {ok}",
+			encoding: smsGSM7,
+		},
+		{
+			name:     "8-bit data",
+			pdu:      "0004" + deliverFrom + "04" + deliverSCTS + "03CAFE01",
+			from:     "+4915112345678",
+			text:     "cafe01",
+			encoding: sms8Bit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := decodeDeliverPDU(tt.pdu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.From != tt.from || msg.Text != tt.text || msg.Encoding != tt.encoding {
+				t.Errorf("got from %q, text %q (%s), want %q, %q (%s)",
+					msg.From, msg.Text, msg.Encoding, tt.from, tt.text, tt.encoding)
+			}
+			if msg.Ref != tt.ref || msg.Parts != tt.parts || msg.Seq != tt.seq {
+				t.Errorf("got concatenation %d %d/%d, want %d %d/%d",
+					msg.Ref, msg.Seq, msg.Parts, tt.ref, tt.seq, tt.parts)
+			}
+		})
+	}
+}
+
+func TestDecodeDeliverPDUTime(t *testing.T) {
+	msg, err := decodeDeliverPDU("0004" + deliverFrom + "00" + deliverSCTS + "00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := msg.Time.Zone(); offset != 3600 {
+		t.Errorf("time zone offset = %d, want 3600", offset)
+	}
+	if got := msg.Time.UTC().Format("2006-01-02 15:04:05"); got != "2025-01-13 13:00:00" {
+		t.Errorf("time = %s UTC, want 2025-01-13 13:00:00", got)
+	}
+}
+
+func TestDecodeDeliverPDUMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  string
+	}{
+		{"not hex", "00XY"},
+		{"truncated header", "0004"},
+		{"truncated address", "00040D919451"},
+		{"not an SMS-DELIVER", "0001" + deliverFrom + "00" + deliverSCTS + "00"},
+		{"GSM 7-bit data shorter than its length", "0004" + deliverFrom + "00" + deliverSCTS + "0AC834"},
+		{"GSM 7-bit length shorter than the header", "0044" + deliverFrom + "00" + deliverSCTS + "01050003420201906536FB0D02"},
+		{"UCS2 length shorter than the header", "0044" + deliverFrom + "08" + deliverSCTS + "030500034202010041"},
+		{"8-bit data shorter than its length", "0004" + deliverFrom + "04" + deliverSCTS + "0ACAFE"},
+		{"header longer than the data", "0044" + deliverFrom + "04" + deliverSCTS + "0509000342"},
+		{"empty data with a header", "0044" + deliverFrom + "04" + deliverSCTS + "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := decodeDeliverPDU(tt.pdu)
+			if err == nil {
+				t.Fatalf("decoded %+v, want an error", msg)
+			}
+			if strings.HasPrefix(tt.name, "not") {
+				return
+			}
+			if !errors.Is(err, errShortPDU) {
+				t.Errorf("error = %v, want errShortPDU", err)
+			}
+		})
+	}
+}
+
+func TestSplitSMS(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		encoding string
+		counts   []int
+	}{
+		{"single GSM 7-bit", strings.Repeat("a", 160), smsGSM7, []int{160}},
+		{"two GSM 7-bit parts", strings.Repeat("a", 161), smsGSM7, []int{153, 8}},
+		{"extension character kept whole", strings.Repeat("a", 152) + "€" + strings.Repeat("x", 10), smsGSM7, []int{152, 12}},
+		{"single UCS2", strings.Repeat("ж", 70), smsUCS2, []int{70}},
+		{"two UCS2 parts", strings.Repeat("ж", 71), smsUCS2, []int{67, 4}},
+		{"surrogate pair kept whole", strings.Repeat("ж", 66) + "😀" + strings.Repeat("ж", 5), smsUCS2, []int{66, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, parts := splitSMS(tt.text)
+			if encoding != tt.encoding {
+				t.Errorf("encoding = %s, want %s", encoding, tt.encoding)
+			}
+			var counts []int
+			for _, part := range parts {
+				counts = append(counts, part.count)
+			}
+			if len(counts) != len(tt.counts) {
+				t.Fatalf("part sizes = %v, want %v", counts, tt.counts)
+			}
+			for i := range counts {
+				if counts[i] != tt.counts[i] {
+					t.Fatalf("part sizes = %v, want %v", counts, tt.counts)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeSubmitPDU(t *testing.T) {
+	encoding, parts := splitSMS("hellohello")
+	pdu, length, err := encodeSubmitPDU("+46708251358", encoding, parts[0], 0, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0001000B916407281553F800000AE8329BFD4697D9EC37"; pdu != want || length != 22 {
+		t.Errorf("got %s (%d), want %s (22)", pdu, length, want)
+	}
+
+	for _, to := range []string{"", "+", "12ab", "+49 151"} {
+		if _, _, err := encodeSubmitPDU(to, encoding, parts[0], 0, 1, 1); err == nil {
+			t.Errorf("encodeSubmitPDU(%q) succeeded", to)
+		}
+	}
+}
+
+// TestSubmitDeliverRoundTrip turns each SUBMIT into the DELIVER the
+// recipient would see and decodes it again
+func TestSubmitDeliverRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		strings.Repeat("x", 150) + " {tail} [end] €5",
+		strings.Repeat("Привет ", 12) + "😀",
+		"short",
+	} {
+		encoding, parts := splitSMS(text)
+		var got strings.Builder
+		for i, part := range parts {
+			pdu, _, err := encodeSubmitPDU("123", encoding, part, 7, i+1, len(parts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// "00" SMSC, first octet and TP-MR, then 03 81 21F3, PID and DCS:
+			// drop TP-MR, mark as DELIVER and add a time stamp before TP-UDL
+			first := "04"
+			if len(parts) > 1 {
+				first = "44"
+			}
+			deliver := "00" + first + pdu[6:18] + deliverSCTS + pdu[18:]
+			msg, err := decodeDeliverPDU(deliver)
+			if err != nil {
+				t.Fatalf("part %d of %q: %v", i+1, text, err)
+			}
+			if len(parts) > 1 && (msg.Ref != 7 || msg.Parts != len(parts) || msg.Seq != i+1) {
+				t.Errorf("part %d: concatenation %d %d/%d", i+1, msg.Ref, msg.Seq, msg.Parts)
+			}
+			got.WriteString(msg.Text)
+		}
+		if got.String() != text {
+			t.Errorf("round trip of %q gave %q", text, got.String())
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProxyError reports a failure in reaching the bridge through a proxy, as
+// opposed to a failure of the bridge itself
+type ProxyError struct {
+	Proxy string
+	Stage string
+	Err   error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("proxy %s: %s: %v", e.Proxy, e.Stage, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// errBridgeUnreachable marks a tunnel the proxy accepted but could not
+// connect through
+var errBridgeUnreachable = errors.New("bridge unreachable from proxy")
+
+// socks5Replies are the SOCKS5 reply codes (RFC 1928)
+var socks5Replies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// proxyFromEnvironment resolves the "env" proxy. Tests replace it, as
+// http.ProxyFromEnvironment reads the environment only once.
+var proxyFromEnvironment = http.ProxyFromEnvironment
+
+// modemProxyURL returns the proxy to use for the bridge, or nil for a direct
+// connection. "env" honours HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func modemProxyURL(config *Config) (*url.URL, error) {
+	var proxyURL *url.URL
+	switch config.ModemProxy {
+	case "":
+		return nil, nil
+	case "env":
+		target, err := url.Parse(config.ModemWSURL)
+		if err != nil {
+			return nil, err
+		}
+		// The environment is keyed by the HTTP scheme the upgrade runs over
+		switch target.Scheme {
+		case "ws":
+			target.Scheme = "http"
+		case "wss":
+			target.Scheme = "https"
+		}
+		proxyURL, err = proxyFromEnvironment(&http.Request{URL: target})
+		if err != nil || proxyURL == nil {
+			return nil, err
+		}
+	default:
+		var err error
+		proxyURL, err = url.Parse(config.ModemProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	return proxyURL, nil
+}
+
+// proxyDialContext returns a dial function that tunnels through proxyURL
+func proxyDialContext(proxyURL *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		name := proxyURL.Redacted()
+
+		proxyAddr := proxyURL.Host
+		if proxyURL.Port() == "" {
+			if proxyURL.Scheme == "http" {
+				proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "8080")
+			} else {
+				proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "1080")
+			}
+		}
+
+		// socks5 resolves the bridge name here, socks5h leaves it to the proxy
+		target := addr
+		if proxyURL.Scheme == "socks5" {
+			var err error
+			if target, err = resolveHostPort(ctx, addr); err != nil {
+				return nil, &ProxyError{Proxy: name, Stage: "resolve bridge " + addr, Err: err}
+			}
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, proxyAddr)
+		if err != nil {
+			return nil, &ProxyError{Proxy: name, Stage: "connect to proxy", Err: err}
+		}
+
+		// Bound the proxy handshake by the dial context
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		if proxyURL.Scheme == "http" {
+			err = httpConnect(conn, proxyURL, addr)
+		} else {
+			err = socks5Connect(conn, proxyURL, target)
+		}
+		if err != nil {
+			conn.Close()
+			stage := "proxy handshake"
+			if errors.Is(err, errBridgeUnreachable) {
+				stage = "reach bridge " + addr
+			}
+			return nil, &ProxyError{Proxy: name, Stage: stage, Err: err}
+		}
+
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// httpConnect opens a tunnel with HTTP CONNECT
+func httpConnect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// The bridge only speaks after we do, so nothing past the response
+	// headers can be lost in the reader's buffer
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: CONNECT returned %s", errBridgeUnreachable, resp.Status)
+	default:
+		return fmt.Errorf("CONNECT rejected: %s", resp.Status)
+	}
+	return nil
+}
+
+// resolveHostPort replaces a host name in addr with its first address
+func resolveHostPort(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("no address for %s", host)
+	}
+	return net.JoinHostPort(addrs[0].IP.String(), port), nil
+}
+
+// socks5Connect opens a tunnel with SOCKS5 (RFC 1928/1929). A host name in
+// addr is sent unresolved for the proxy to resolve.
+func socks5Connect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	// Greeting: offer no-auth, plus username/password when configured
+	methods := []byte{0x00}
+	if proxyURL.User != nil {
+		methods = append(methods, 0x02)
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errors.New("not a SOCKS5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxyURL.User == nil {
+			return errors.New("proxy requires authentication")
+		}
+		user := proxyURL.User.Username()
+		password, _ := proxyURL.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("proxy credentials too long")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("proxy authentication failed")
+		}
+	default:
+		return errors.New("no acceptable authentication method")
+	}
+
+	// CONNECT request
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 0x01), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 0x04), ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("host name too long")
+		}
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	switch header[1] {
+	case 0x00:
+	case 3, 4, 5, 6:
+		return fmt.Errorf("%w: %s", errBridgeUnreachable, socks5Replies[header[1]])
+	default:
+		if msg, ok := socks5Replies[header[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("SOCKS5 reply %d", header[1])
+	}
+
+	// Skip the bound address
+	var skip int
+	switch header[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("unknown SOCKS5 address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// proxyLabel describes the proxy for error messages, or "" for none
+func proxyLabel(proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return ""
+	}
+	return " via proxy " + strings.TrimSuffix(proxyURL.Redacted(), "/")
+}
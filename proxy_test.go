@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestModemProxyURL(t *testing.T) {
+	envProxies := map[string]string{
+		"http":  "socks5://10.0.0.1:1080",
+		"https": "https://10.0.0.2:3128",
+	}
+	defer func(f func(*http.Request) (*url.URL, error)) { proxyFromEnvironment = f }(proxyFromEnvironment)
+	proxyFromEnvironment = func(r *http.Request) (*url.URL, error) {
+		if r.URL.Host == "bridge.lan" || envProxies[r.URL.Scheme] == "" {
+			return nil, nil
+		}
+		return url.Parse(envProxies[r.URL.Scheme])
+	}
+
+	tests := []struct {
+		proxy   string
+		bridge  string
+		want    string
+		wantErr bool
+	}{
+		{proxy: "", bridge: "ws://10.0.0.9/modem", want: ""},
+		{proxy: "http://proxy:3128", bridge: "ws://10.0.0.9/modem", want: "http://proxy:3128"},
+		{proxy: "socks5h://proxy", bridge: "ws://10.0.0.9/modem", want: "socks5h://proxy"},
+		{proxy: "https://proxy:3128", bridge: "ws://10.0.0.9/modem", wantErr: true},
+		{proxy: "env", bridge: "ws://10.0.0.9/modem", want: "socks5://10.0.0.1:1080"},
+		{proxy: "env", bridge: "ws://bridge.lan/modem", want: ""},
+		{proxy: "env", bridge: "wss://10.0.0.9/modem", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := modemProxyURL(&Config{ModemProxy: tt.proxy, ModemWSURL: tt.bridge})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("modemProxyURL(%q, %q) = %v, want an error", tt.proxy, tt.bridge, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("modemProxyURL(%q, %q): %v", tt.proxy, tt.bridge, err)
+			continue
+		}
+		gotURL := ""
+		if got != nil {
+			gotURL = got.String()
+		}
+		if gotURL != tt.want {
+			t.Errorf("modemProxyURL(%q, %q) = %v, want %q", tt.proxy, tt.bridge, got, tt.want)
+		}
+	}
+}
+
+// fakeProxy accepts one connection on a local listener and hands it to
+// serve. It returns the listener address.
+func fakeProxy(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestHTTPConnect(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		status    string
+		wantAuth  string
+		wantStage string
+	}{
+		{name: "tunnel", status: "200 Connection established"},
+		{name: "credentials", user: "user:secret@", status: "200 OK", wantAuth: "Basic dXNlcjpzZWNyZXQ="},
+		{name: "auth required", status: "407 Proxy Authentication Required", wantStage: "proxy handshake"},
+		{name: "bridge down", status: "502 Bad Gateway", wantStage: "reach bridge bridge.lan:80"},
+		{name: "bridge timeout", status: "504 Gateway Timeout", wantStage: "reach bridge bridge.lan:80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan *http.Request, 1)
+			addr := fakeProxy(t, func(conn net.Conn) {
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				requests <- req
+				io.WriteString(conn, "HTTP/1.1 "+tt.status+"\r\n\r\n")
+			})
+
+			proxyURL, _ := url.Parse("http://" + tt.user + addr)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			conn, err := proxyDialContext(proxyURL)(ctx, "tcp", "bridge.lan:80")
+
+			req := <-requests
+			if req.Method != http.MethodConnect || req.Host != "bridge.lan:80" {
+				t.Errorf("proxy got %s %s, want CONNECT bridge.lan:80", req.Method, req.Host)
+			}
+			if got := req.Header.Get("Proxy-Authorization"); got != tt.wantAuth {
+				t.Errorf("Proxy-Authorization = %q, want %q", got, tt.wantAuth)
+			}
+			checkProxyResult(t, conn, err, tt.wantStage)
+		})
+	}
+}
+
+// socks5Request is what the fake SOCKS5 proxy received
+type socks5Request struct {
+	methods  []byte
+	user     string
+	password string
+	addrType byte
+	host     string
+	port     int
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	tests := []struct {
+		name      string
+		scheme    string
+		user      string
+		method    byte // selected by the proxy
+		authOK    bool
+		reply     byte
+		want      socks5Request
+		wantStage string
+	}{
+		{
+			name:   "socks5h sends the host name",
+			scheme: "socks5h",
+			want:   socks5Request{methods: []byte{0x00}, addrType: 0x03, host: "localhost", port: 80},
+		},
+		{
+			name:   "socks5 resolves locally",
+			scheme: "socks5",
+			want:   socks5Request{methods: []byte{0x00}, addrType: 0x01, host: "127.0.0.1", port: 80},
+		},
+		{
+			name:   "username and password",
+			scheme: "socks5h",
+			user:   "user:secret@",
+			method: 0x02,
+			authOK: true,
+			want:   socks5Request{methods: []byte{0x00, 0x02}, user: "user", password: "secret", addrType: 0x03, host: "localhost", port: 80},
+		},
+		{
+			name:      "authentication failure",
+			scheme:    "socks5h",
+			user:      "user:wrong@",
+			method:    0x02,
+			want:      socks5Request{methods: []byte{0x00, 0x02}, user: "user", password: "wrong"},
+			wantStage: "proxy handshake",
+		},
+		{
+			name:      "authentication required without credentials",
+			scheme:    "socks5h",
+			method:    0x02,
+			want:      socks5Request{methods: []byte{0x00}},
+			wantStage: "proxy handshake",
+		},
+		{
+			name:      "no acceptable method",
+			scheme:    "socks5h",
+			method:    0xff,
+			want:      socks5Request{methods: []byte{0x00}},
+			wantStage: "proxy handshake",
+		},
+		{
+			name:      "connection refused",
+			scheme:    "socks5h",
+			reply:     5,
+			want:      socks5Request{methods: []byte{0x00}, addrType: 0x03, host: "localhost", port: 80},
+			wantStage: "reach bridge localhost:80",
+		},
+		{
+			name:      "not allowed by ruleset",
+			scheme:    "socks5h",
+			reply:     2,
+			want:      socks5Request{methods: []byte{0x00}, addrType: 0x03, host: "localhost", port: 80},
+			wantStage: "proxy handshake",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan socks5Request, 1)
+			addr := fakeProxy(t, func(conn net.Conn) {
+				var got socks5Request
+				defer func() { requests <- got }()
+				serveSOCKS5(conn, &got, tt.method, tt.authOK, tt.reply)
+			})
+
+			proxyURL, _ := url.Parse(tt.scheme + "://" + tt.user + addr)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			conn, err := proxyDialContext(proxyURL)(ctx, "tcp", "localhost:80")
+
+			got := <-requests
+			if tt.scheme == "socks5" && got.addrType == 0x04 && got.host == "::1" {
+				// localhost may resolve to IPv6 first
+				got.addrType, got.host = 0x01, "127.0.0.1"
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("proxy got %+v, want %+v", got, tt.want)
+			}
+			checkProxyResult(t, conn, err, tt.wantStage)
+		})
+	}
+}
+
+// serveSOCKS5 plays the proxy side of a SOCKS5 handshake, recording the
+// client's requests in got
+func serveSOCKS5(conn net.Conn, got *socks5Request, method byte, authOK bool, reply byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	got.methods = make([]byte, header[1])
+	if _, err := io.ReadFull(conn, got.methods); err != nil {
+		return
+	}
+	conn.Write([]byte{0x05, method})
+
+	switch method {
+	case 0x00:
+	case 0x02:
+		got.user, got.password = readSOCKS5Auth(conn)
+		if !authOK {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	default:
+		return
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	got.addrType = request[3]
+	var host []byte
+	switch got.addrType {
+	case 0x01:
+		host = make([]byte, net.IPv4len)
+	case 0x04:
+		host = make([]byte, net.IPv6len)
+	case 0x03:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		host = make([]byte, n[0])
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, host)
+	io.ReadFull(conn, port)
+	if got.addrType == 0x03 {
+		got.host = string(host)
+	} else {
+		got.host = net.IP(host).String()
+	}
+	got.port = int(binary.BigEndian.Uint16(port))
+
+	conn.Write([]byte{0x05, reply, 0x00, 0x01, 10, 0, 0, 1, 0x1f, 0x90})
+}
+
+func readSOCKS5Auth(conn net.Conn) (string, string) {
+	field := func() string {
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		b := make([]byte, n[0])
+		io.ReadFull(conn, b)
+		return string(b)
+	}
+	version := make([]byte, 1)
+	io.ReadFull(conn, version)
+	user := field()
+	return user, field()
+}
+
+// checkProxyResult checks a dial through the proxy succeeded, or failed at
+// wantStage
+func checkProxyResult(t *testing.T, conn net.Conn, err error, wantStage string) {
+	t.Helper()
+	if wantStage == "" {
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.Close()
+		return
+	}
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		t.Fatalf("dial error = %v, want a ProxyError", err)
+	}
+	if proxyErr.Stage != wantStage {
+		t.Errorf("stage = %q, want %q (%v)", proxyErr.Stage, wantStage, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultPollCommands is the default -poll-commands schedule
+const defaultPollCommands = "hcsq=30s,csq=60s,dsflow=30s,sysinfoex=60s,cops=120s,cereg=60s,hfreqinfo=60s,monsc=60s,monnc=60s"
+
+// pollCheckInterval is how often the scheduler looks for stale metrics
+const pollCheckInterval = time.Second
+
+// pollCommands maps each metric to the query that refreshes it
+var pollCommands = map[string]string{
+	"hcsq":      "AT^HCSQ?",
+	"csq":       "AT+CSQ",
+	"dsflow":    "AT^DSFLOWQRY",
+	"sysinfoex": "AT^SYSINFOEX",
+	"cops":      "AT+COPS?",
+	"cereg":     "AT+CEREG?",
+	"hfreqinfo": "AT^HFREQINFO?",
+	"monsc":     "AT^MONSC",
+	"monnc":     "AT^MONNC",
+}
+
+// pollJob queries a metric when no report has refreshed it for Interval
+type pollJob struct {
+	Name     string
+	Command  string
+	Interval time.Duration
+	Enabled  bool
+}
+
+// parsePollSchedule parses "name=interval" pairs such as "hcsq=30s,csq=off".
+// Metrics that are not mentioned keep their default interval.
+func parsePollSchedule(spec string) ([]pollJob, error) {
+	intervals := map[string]string{}
+	for _, pair := range strings.Split(defaultPollCommands+","+spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid poll entry %q (want name=interval)", pair)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, known := pollCommands[name]; !known {
+			return nil, fmt.Errorf("unknown poll metric %q", name)
+		}
+		intervals[name] = strings.TrimSpace(value)
+	}
+
+	var jobs []pollJob
+	for _, name := range []string{"hcsq", "csq", "dsflow", "sysinfoex", "cops", "cereg", "hfreqinfo", "monsc", "monnc"} {
+		job := pollJob{Name: name, Command: pollCommands[name]}
+		switch value := intervals[name]; value {
+		case "off", "0":
+		default:
+			interval, err := time.ParseDuration(value)
+			if err != nil || interval < 0 {
+				return nil, fmt.Errorf("invalid poll interval for %s: %q", name, value)
+			}
+			job.Interval = interval
+			job.Enabled = true
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// markRefreshed records that a report or poll reply updated a metric
+func (w *WebSocketClient) markRefreshed(metric string) {
+	w.refreshMu.Lock()
+	defer w.refreshMu.Unlock()
+
+	if w.refreshed == nil {
+		w.refreshed = make(map[string]time.Time)
+	}
+	w.refreshed[metric] = time.Now()
+}
+
+func (w *WebSocketClient) lastRefreshed(metric string) time.Time {
+	w.refreshMu.Lock()
+	defer w.refreshMu.Unlock()
+	return w.refreshed[metric]
+}
+
+// runPoller queries metrics that unsolicited reports have stopped refreshing,
+// e.g. when ^CURC is off. Replies reach the parsers through handleLine. It
+// runs for one session and returns when done is closed.
+func (w *WebSocketClient) runPoller(ctx context.Context, done <-chan struct{}) {
+	jobs := make([]pollJob, 0, len(w.pollJobs))
+	lastPoll := make(map[string]time.Time)
+	start := time.Now()
+	for _, job := range w.pollJobs {
+		if job.Enabled {
+			jobs = append(jobs, job)
+			// Give the reports a full interval to show up first
+			lastPoll[job.Name] = start
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(pollCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		for i := 0; i < len(jobs); i++ {
+			job := jobs[i]
+			now := time.Now()
+			if now.Sub(w.lastRefreshed(job.Name)) < job.Interval ||
+				now.Sub(lastPoll[job.Name]) < job.Interval {
+				continue
+			}
+			lastPoll[job.Name] = now
+
+			w.logger.Printf("DEBUG: %s not refreshed for %v, polling with %s", job.Name, job.Interval, job.Command)
+			_, err := w.SendAT(ctx, job.Command)
+			switch {
+			case err == nil:
+			case errors.Is(err, errReadOnlySource):
+				w.logger.Printf("INFO: Active polling disabled: %v", err)
+				return
+			case errors.Is(err, ErrATError), errors.Is(err, ErrATNotSupported):
+				// Not every firmware knows every query; stop asking this session
+				w.logger.Printf("WARN: Modem rejected %s, no longer polling %s: %v", job.Command, job.Name, err)
+				jobs = append(jobs[:i], jobs[i+1:]...)
+				i--
+			default:
+				w.logger.Printf("WARN: Poll %s failed: %v", job.Command, err)
+			}
+		}
+	}
+}
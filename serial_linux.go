@@ -0,0 +1,329 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// serialWatchInterval is how often the device node is checked for USB
+// re-enumeration while a port is open
+const serialWatchInterval = 2 * time.Second
+
+// serialCRTSCTS is missing from package syscall; unlike CBAUD and TCFLSH
+// (see the serial_termios files) it has the same value on every architecture
+const serialCRTSCTS = 0x80000000
+
+var serialBaudRates = map[int]uint32{
+	9600:    syscall.B9600,
+	19200:   syscall.B19200,
+	38400:   syscall.B38400,
+	57600:   syscall.B57600,
+	115200:  syscall.B115200,
+	230400:  syscall.B230400,
+	460800:  syscall.B460800,
+	921600:  syscall.B921600,
+	1000000: syscall.B1000000,
+	2000000: syscall.B2000000,
+	3000000: syscall.B3000000,
+	4000000: syscall.B4000000,
+}
+
+// serialSource talks to the modem AT port directly through a tty device
+type serialSource struct {
+	config *Config
+	logger *log.Logger
+
+	mu   sync.Mutex // guards file, done and buf
+	file *os.File
+	done chan struct{}
+	buf  []byte
+}
+
+func newSerialSource(config *Config, logger *log.Logger) (*serialSource, error) {
+	if _, ok := serialBaudRates[config.SerialBaud]; !ok {
+		return nil, fmt.Errorf("unsupported serial baud rate %d", config.SerialBaud)
+	}
+	if _, err := parseSerialMode(config.SerialMode); err != nil {
+		return nil, err
+	}
+	return &serialSource{
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (s *serialSource) String() string {
+	return fmt.Sprintf("serial %s@%d,%s", s.config.SerialDevice, s.config.SerialBaud, s.config.SerialMode)
+}
+
+func (s *serialSource) Connect(ctx context.Context) error {
+	// O_NONBLOCK registers the tty with the runtime poller so that Close
+	// unblocks a pending read
+	file, err := os.OpenFile(s.config.SerialDevice, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open serial device: %v", err)
+	}
+
+	if err := s.configure(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to configure serial device: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat serial device: %v", err)
+	}
+
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.file = file
+	s.done = done
+	s.buf = s.buf[:0]
+	s.mu.Unlock()
+
+	go s.watchDevice(ctx, file, info, done)
+
+	return nil
+}
+
+// configure puts the tty into raw mode with the configured line settings
+func (s *serialSource) configure(file *os.File) error {
+	mode, err := parseSerialMode(s.config.SerialMode)
+	if err != nil {
+		return err
+	}
+	baud := serialBaudRates[s.config.SerialBaud]
+
+	raw, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ioctlErr error
+	err = raw.Control(func(fd uintptr) {
+		t, err := getTermios(fd)
+		if err != nil {
+			ioctlErr = err
+			return
+		}
+
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+			syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.PARODD | syscall.CSTOPB | serialCRTSCTS | serialCBAUD
+		t.Cflag |= mode.cflag | syscall.CLOCAL | syscall.CREAD | baud
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+
+		if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(t)); err != nil {
+			ioctlErr = err
+			return
+		}
+		// Drop whatever the modem printed before we got here
+		ioctlErr = ioctlValue(fd, serialTCFLSH, syscall.TCIFLUSH)
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+// getTermios reads the tty settings of fd
+func getTermios(fd uintptr) (*serialTermios, error) {
+	t := new(serialTermios)
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(t)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ioctl issues request on fd with a pointer argument, as package syscall has
+// no wrapper for it. The pointer is converted in the Syscall call itself so
+// that the referenced memory stays live for the duration of the call.
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ioctlValue issues request on fd with an integer argument
+func ioctlValue(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// ReadFrame returns the next CR/LF-terminated line. The SMS input prompt,
+// which is not followed by a line terminator, is returned on its own.
+func (s *serialSource) ReadFrame() ([]byte, error) {
+	s.mu.Lock()
+	file := s.file
+	s.mu.Unlock()
+	if file == nil {
+		return nil, errNotConnected
+	}
+
+	chunk := make([]byte, 512)
+	for {
+		s.mu.Lock()
+		if line, ok := s.nextLine(); ok {
+			s.mu.Unlock()
+			return line, nil
+		}
+		s.mu.Unlock()
+
+		n, err := file.Read(chunk)
+		if n > 0 {
+			s.mu.Lock()
+			s.buf = append(s.buf, chunk[:n]...)
+			s.mu.Unlock()
+			continue
+		}
+		if err == io.EOF {
+			// A tty reads EOF once the USB device is gone
+			return nil, fmt.Errorf("serial device closed")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("serial read error: %v", err)
+		}
+	}
+}
+
+// nextLine extracts one non-empty line from buf. Callers must hold mu.
+func (s *serialSource) nextLine() ([]byte, bool) {
+	for {
+		i := bytes.IndexAny(s.buf, "\r\n")
+		if i < 0 {
+			if bytes.Equal(s.buf, []byte("> ")) {
+				s.buf = s.buf[:0]
+				return []byte("> "), true
+			}
+			return nil, false
+		}
+
+		line := bytes.TrimSpace(s.buf[:i])
+		s.buf = s.buf[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+
+		frame := make([]byte, 0, len(line)+2)
+		frame = append(frame, line...)
+		return append(frame, '\r', '\n'), true
+	}
+}
+
+func (s *serialSource) WriteFrame(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errNotConnected
+	}
+	s.file.SetWriteDeadline(time.Now().Add(s.config.RequestTimeout))
+	_, err := s.file.Write(data)
+	return err
+}
+
+func (s *serialSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.file.Close()
+	s.file = nil
+	s.done = nil
+	return err
+}
+
+// watchDevice closes the port when the device node disappears or is replaced
+// by a different device, as happens when the stick re-enumerates on the USB
+// bus. The kernel does not always fail reads on the stale descriptor.
+func (s *serialSource) watchDevice(ctx context.Context, file *os.File, opened os.FileInfo, done chan struct{}) {
+	ticker := time.NewTicker(serialWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			current, err := os.Stat(s.config.SerialDevice)
+			if err == nil && sameDevice(opened, current) {
+				continue
+			}
+			s.logger.Printf("WARN: Serial device %s went away, closing port", s.config.SerialDevice)
+			file.Close()
+			return
+		}
+	}
+}
+
+func sameDevice(a, b os.FileInfo) bool {
+	sa, okA := a.Sys().(*syscall.Stat_t)
+	sb, okB := b.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return os.SameFile(a, b)
+	}
+	return sa.Rdev == sb.Rdev && sa.Ino == sb.Ino
+}
+
+type serialMode struct {
+	cflag uint32
+}
+
+// parseSerialMode parses line settings such as "8N1" or "7E1"
+func parseSerialMode(mode string) (serialMode, error) {
+	var m serialMode
+	if len(mode) != 3 {
+		return m, fmt.Errorf("invalid serial mode %q (want e.g. 8N1)", mode)
+	}
+
+	switch mode[0] {
+	case '8':
+		m.cflag |= syscall.CS8
+	case '7':
+		m.cflag |= syscall.CS7
+	default:
+		return m, fmt.Errorf("invalid serial data bits in %q", mode)
+	}
+
+	switch mode[1] {
+	case 'N', 'n':
+	case 'E', 'e':
+		m.cflag |= syscall.PARENB
+	case 'O', 'o':
+		m.cflag |= syscall.PARENB | syscall.PARODD
+	default:
+		return m, fmt.Errorf("invalid serial parity in %q", mode)
+	}
+
+	switch mode[2] {
+	case '1':
+	case '2':
+		m.cflag |= syscall.CSTOPB
+	default:
+		return m, fmt.Errorf("invalid serial stop bits in %q", mode)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPTY returns the master side of a new pseudo-terminal and the path of
+// its slave device
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal support: %v", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		t.Fatalf("unlockpt: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		t.Fatalf("ptsname: %v", err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func TestSerialSourcePTYRoundTrip(t *testing.T) {
+	master, device := openPTY(t)
+
+	config := &Config{
+		SerialDevice:   device,
+		SerialBaud:     115200,
+		SerialMode:     "8N1",
+		RequestTimeout: time.Second,
+	}
+	source, err := newSerialSource(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	// Modem to host: lines are split on CR/LF, blank lines dropped and the
+	// SMS prompt returned on its own
+	if _, err := master.Write([]byte("\r\n^RSSI: 20\r\n\r\nOK\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"^RSSI: 20\r\n", "OK\r\n"} {
+		frame, err := source.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != want {
+			t.Errorf("ReadFrame() = %q, want %q", frame, want)
+		}
+	}
+	if _, err := master.Write([]byte("> ")); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := source.ReadFrame(); err != nil || string(frame) != "> " {
+		t.Errorf("ReadFrame() = %q, %v, want the prompt", frame, err)
+	}
+
+	// Host to modem: raw mode passes CR through untranslated
+	if err := source.WriteFrame([]byte("AT+CSQ\r")); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 0, 16)
+	buf := make([]byte, 16)
+	for !bytes.HasSuffix(got, []byte("\r")) {
+		n, err := master.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "AT+CSQ\r" {
+		t.Errorf("modem read %q, want %q", got, "AT+CSQ\r")
+	}
+
+	// Close unblocks a pending read
+	errs := make(chan error, 1)
+	go func() {
+		_, err := source.ReadFrame()
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	source.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("ReadFrame() after Close returned no error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ReadFrame() still blocked after Close")
+	}
+}
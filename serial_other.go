@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+)
+
+// serialSource is only implemented on Linux
+type serialSource struct {
+	ModemSource
+}
+
+func newSerialSource(config *Config, logger *log.Logger) (*serialSource, error) {
+	return nil, fmt.Errorf("serial source is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,19 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !ppc64 && !ppc64le
+
+package main
+
+// serialTermios is the kernel's struct termios, which package syscall
+// describes with the C library layout instead
+type serialTermios struct {
+	Iflag uint32
+	Oflag uint32
+	Cflag uint32
+	Lflag uint32
+	Line  uint8
+	Cc    [19]uint8
+}
+
+const (
+	serialCBAUD  = 0x100f
+	serialTCFLSH = 0x540b
+)
@@ -0,0 +1,22 @@
+//go:build linux && (ppc64 || ppc64le)
+
+package main
+
+// serialTermios is the kernel's struct termios, which package syscall
+// describes with the C library layout instead. On powerpc the control
+// characters come before the line discipline and the speeds are included.
+type serialTermios struct {
+	Iflag  uint32
+	Oflag  uint32
+	Cflag  uint32
+	Lflag  uint32
+	Cc     [19]uint8
+	Line   uint8
+	Ispeed uint32
+	Ospeed uint32
+}
+
+const (
+	serialCBAUD  = 0xff
+	serialTCFLSH = 0x2000741f
+)
@@ -3,30 +3,49 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"text/template"
 	"time"
 )
 
-func NewServer(config *Config, modemStatus *ModemStatus, logger *log.Logger) *Server {
+func NewServer(config *Config, modems []*Modem, logger *log.Logger) *Server {
+	modemByID := make(map[string]*Modem, len(modems))
+	for _, m := range modems {
+		modemByID[m.ID] = m
+	}
+
 	return &Server{
-		config:      config,
-		modemStatus: modemStatus,
-		mux:         http.NewServeMux(),
-		logger:      logger,
+		config:    config,
+		modems:    modems,
+		modemByID: modemByID,
+		mux:       http.NewServeMux(),
+		logger:    logger,
+		atPolicy:  NewATPolicy(config.ATAllow, config.ATDeny),
 	}
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	s.logger.Printf("Starting modem monitoring server on port %s", s.config.WebPort)
-	s.logger.Printf("Modem WebSocket URL: %s", s.config.ModemWSURL)
 
-	// Create WebSocket client
-	s.wsClient = NewWebSocketClient(s.config, s.modemStatus, s.logger)
+	atAudit, err := newATAuditor(s.config.ATAuditLog, s.logger)
+	if err != nil {
+		return err
+	}
+	s.atAudit = atAudit
+	defer s.atAudit.Close()
 
-	// Start WebSocket client
-	go s.wsClient.Start(ctx)
+	// Start modem clients
+	clientErr := make(chan error, len(s.modems))
+	for _, m := range s.modems {
+		s.logger.Printf("Modem %s source: %s", m.ID, m.Client.source)
+		go func(m *Modem) {
+			if err := m.Client.Start(ctx); err != nil {
+				clientErr <- fmt.Errorf("modem %s: %v", m.ID, err)
+			}
+		}(m)
+	}
 
 	// Setup HTTP routes
 	s.setupRoutes()
@@ -49,20 +68,25 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}()
 
-	// Wait for context cancellation or server error
+	// Wait for context cancellation, server error or a modem client giving up
+	var exitErr error
 	select {
 	case <-ctx.Done():
 		s.logger.Println("Shutdown signal received, closing server...")
 	case err := <-serverErr:
 		s.logger.Printf("Server error: %v", err)
+	case exitErr = <-clientErr:
+		s.logger.Printf("Modem client failed: %v", exitErr)
 	}
 
 	// Graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 
-	// Stop WebSocket client
-	s.wsClient.Stop()
+	// Stop modem clients
+	for _, m := range s.modems {
+		m.Client.Stop()
+	}
 
 	// Shutdown HTTP server
 	if err := server.Shutdown(shutdownCtx); err != nil {
@@ -70,81 +94,182 @@ func (s *Server) Start(ctx context.Context) error {
 		return err
 	}
 
-	return nil
+	return exitErr
+}
+
+// extendWriteDeadline lets a handler that waits up to wait for the modem
+// still answer after the server's WriteTimeout has passed
+func (s *Server) extendWriteDeadline(w http.ResponseWriter, wait time.Duration) {
+	deadline := time.Now().Add(wait + s.config.RequestTimeout)
+	if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+		s.logger.Printf("DEBUG: Cannot extend write deadline: %v", err)
+	}
 }
 
 func (s *Server) setupRoutes() {
-	// API endpoints
-	s.mux.HandleFunc("/api/status", s.handleStatusAPI)
-	s.mux.HandleFunc("/api/stats", s.handleStatsAPI)
-	s.mux.HandleFunc("/api/flow", s.handleFlowAPI)
-	s.mux.HandleFunc("/api/health", s.handleHealthAPI)
+	// API endpoints for the first modem, kept for single-modem setups
+	s.mux.HandleFunc("/api/status", s.withModem(s.handleStatusAPI))
+	s.mux.HandleFunc("/api/stats", s.withModem(s.handleStatsAPI))
+	s.mux.HandleFunc("/api/flow", s.withModem(s.handleFlowAPI))
+	s.mux.HandleFunc("/api/health", s.withModem(s.handleHealthAPI))
+	s.mux.HandleFunc("/api/events", s.withModem(s.handleEventsAPI))
+	s.mux.HandleFunc("/api/cells", s.withModem(s.handleCellsAPI))
+	s.mux.HandleFunc("GET /api/sms", s.withModem(s.handleSMSListAPI))
+	s.mux.HandleFunc("GET /api/sms/{sms}", s.withModem(s.handleSMSReadAPI))
+	s.mux.HandleFunc("DELETE /api/sms/{sms}", s.withModem(s.handleSMSDeleteAPI))
+	s.mux.HandleFunc("POST /api/sms/send", s.withModem(s.handleSMSSendAPI))
+	s.mux.HandleFunc("GET /api/ussd", s.withModem(s.handleUSSDStateAPI))
+	s.mux.HandleFunc("POST /api/ussd", s.withModem(s.handleUSSDAPI))
+	s.mux.HandleFunc("DELETE /api/ussd", s.withModem(s.handleUSSDCancelAPI))
+	s.mux.HandleFunc("POST /api/at", s.withModem(s.handleATAPI))
+
+	// Per-modem API endpoints
+	s.mux.HandleFunc("/api/modems", s.handleModemsAPI)
+	s.mux.HandleFunc("/api/modems/{id}/status", s.withModem(s.handleStatusAPI))
+	s.mux.HandleFunc("/api/modems/{id}/stats", s.withModem(s.handleStatsAPI))
+	s.mux.HandleFunc("/api/modems/{id}/flow", s.withModem(s.handleFlowAPI))
+	s.mux.HandleFunc("/api/modems/{id}/health", s.withModem(s.handleHealthAPI))
+	s.mux.HandleFunc("/api/modems/{id}/events", s.withModem(s.handleEventsAPI))
+	s.mux.HandleFunc("/api/modems/{id}/cells", s.withModem(s.handleCellsAPI))
+	s.mux.HandleFunc("GET /api/modems/{id}/sms", s.withModem(s.handleSMSListAPI))
+	s.mux.HandleFunc("GET /api/modems/{id}/sms/{sms}", s.withModem(s.handleSMSReadAPI))
+	s.mux.HandleFunc("DELETE /api/modems/{id}/sms/{sms}", s.withModem(s.handleSMSDeleteAPI))
+	s.mux.HandleFunc("POST /api/modems/{id}/sms/send", s.withModem(s.handleSMSSendAPI))
+	s.mux.HandleFunc("GET /api/modems/{id}/ussd", s.withModem(s.handleUSSDStateAPI))
+	s.mux.HandleFunc("POST /api/modems/{id}/ussd", s.withModem(s.handleUSSDAPI))
+	s.mux.HandleFunc("DELETE /api/modems/{id}/ussd", s.withModem(s.handleUSSDCancelAPI))
+	s.mux.HandleFunc("POST /api/modems/{id}/at", s.withModem(s.handleATAPI))
 
 	// Web dashboard
 	s.mux.HandleFunc("/", s.handleDashboard)
+	s.mux.HandleFunc("/inbox", s.handleInbox)
 
 	// Static files
 	s.mux.Handle("/static/", http.StripPrefix("/static/",
 		http.FileServer(http.Dir("./static"))))
 }
 
+// modemHandlerFunc is an API handler bound to one modem
+type modemHandlerFunc func(w http.ResponseWriter, r *http.Request, m *Modem)
+
+// withModem resolves the {id} path value, falling back to the first modem
+// on routes without one
+func (s *Server) withModem(fn modemHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := s.modems[0]
+		if id := r.PathValue("id"); id != "" {
+			var ok bool
+			if m, ok = s.modemByID[id]; !ok {
+				http.Error(w, "unknown modem "+id, http.StatusNotFound)
+				return
+			}
+		}
+		fn(w, r, m)
+	}
+}
+
 // HTTP Handlers
-func (s *Server) handleStatusAPI(w http.ResponseWriter, r *http.Request) {
-	s.modemStatus.mu.RLock()
-	defer s.modemStatus.mu.RUnlock()
+func (s *Server) handleModemsAPI(w http.ResponseWriter, r *http.Request) {
+	summaries := make([]modemSummary, 0, len(s.modems))
+	for _, m := range s.modems {
+		summaries = append(summaries, m.Summary())
+	}
 
-	// Calculate uptime
-	uptime := time.Since(s.wsClient.stats.LastDisconnect)
-	if s.modemStatus.IsConnected {
-		s.modemStatus.ConnectionStats.Uptime = uptime
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+func (s *Server) handleStatusAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	m.Status.mu.RLock()
+	defer m.Status.mu.RUnlock()
+
+	// Uptime and latency go into a copy: other requests hold the same read lock
+	status := struct {
+		*ModemStatus
+		ConnectionStats ConnectionStats `json:"connection_stats"`
+	}{
+		ModemStatus:     m.Status,
+		ConnectionStats: m.Status.ConnectionStats,
+	}
+	if m.Status.IsConnected {
+		status.ConnectionStats.Uptime = time.Since(m.Client.Stats().LastDisconnect)
 	}
+	status.ConnectionStats.Latency = m.Client.Latency()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.modemStatus)
+	json.NewEncoder(w).Encode(status)
 }
 
-func (s *Server) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleStatsAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	m.Status.mu.RLock()
+	connected := m.Status.IsConnected
+	m.Status.mu.RUnlock()
+
 	stats := struct {
-		ConnectionStats ConnectionStats `json:"connection_stats"`
-		Config          Config          `json:"config"`
+		ID              string                 `json:"id"`
+		ConnectionStats ConnectionStats        `json:"connection_stats"`
+		Reconnect       ReconnectState         `json:"reconnect"`
+		Parsers         map[string]ParserStats `json:"parsers"`
+		Config          Config                 `json:"config"`
 	}{
-		ConnectionStats: *s.wsClient.stats,
-		Config:          *s.config,
+		ID:              m.ID,
+		ConnectionStats: m.Client.Stats(),
+		Reconnect:       m.Client.ReconnectState(),
+		Parsers:         m.Client.ParserStats(),
+		Config:          *m.Config,
 	}
 
 	// Update uptime
-	if s.modemStatus.IsConnected {
-		stats.ConnectionStats.Uptime = time.Since(s.wsClient.stats.LastDisconnect)
+	if connected {
+		stats.ConnectionStats.Uptime = time.Since(stats.ConnectionStats.LastDisconnect)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
-func (s *Server) handleFlowAPI(w http.ResponseWriter, r *http.Request) {
-	s.modemStatus.mu.RLock()
-	defer s.modemStatus.mu.RUnlock()
+func (s *Server) handleFlowAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	m.Status.mu.RLock()
+	defer m.Status.mu.RUnlock()
 
 	// Return only data flow records
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.modemStatus.DataFlow)
+	json.NewEncoder(w).Encode(m.Status.DataFlow)
 }
 
-func (s *Server) handleHealthAPI(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleHealthAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	m.Status.mu.RLock()
+	connected := m.Status.IsConnected
+	lastUpdate := m.Status.LastUpdate
+	m.Status.mu.RUnlock()
+
 	health := struct {
-		Status      string    `json:"status"`
-		LastUpdate  time.Time `json:"last_update"`
-		IsConnected bool      `json:"is_connected"`
-		Uptime      string    `json:"uptime"`
+		ID          string         `json:"id"`
+		Status      string         `json:"status"`
+		LastUpdate  time.Time      `json:"last_update"`
+		IsConnected bool           `json:"is_connected"`
+		Uptime      string         `json:"uptime"`
+		Reconnect   ReconnectState `json:"reconnect"`
+		Init        InitState      `json:"init"`
 	}{
+		ID:          m.ID,
 		Status:      "healthy",
-		LastUpdate:  s.modemStatus.LastUpdate,
-		IsConnected: s.modemStatus.IsConnected,
-		Uptime:      time.Since(s.wsClient.stats.LastDisconnect).String(),
+		LastUpdate:  lastUpdate,
+		IsConnected: connected,
+		Uptime:      time.Since(m.Client.Stats().LastDisconnect).String(),
+		Reconnect:   m.Client.ReconnectState(),
+		Init:        m.Client.InitState(),
 	}
 
-	if !s.modemStatus.IsConnected {
+	if !connected {
 		health.Status = "disconnected"
+	} else if health.Init.State == initFailed {
+		health.Status = "degraded"
+	} else if health.Init.State == initPending || health.Init.State == initRunning {
+		health.Status = "initializing"
+	}
+	if health.Reconnect.State == stateFailed {
+		health.Status = "failed"
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer routes API requests to a single modem backed by client
+func newTestServer(t *testing.T, client *WebSocketClient) *Server {
+	t.Helper()
+	m := &Modem{ID: "test", Config: client.config, Status: client.modemStatus, Client: client}
+	s := NewServer(client.config, []*Modem{m}, log.New(io.Discard, "", 0))
+	s.setupRoutes()
+	return s
+}
+
+// getJSON serves a GET request for path and decodes the response into v
+func getJSON(t *testing.T, s *Server, path string, v any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, rec.Code, rec.Body)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+func TestStatsAPIWhileReceiving(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	s := newTestServer(t, client)
+
+	// Run with -race: the handler snapshots the stats the client is writing
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			client.handleMessage([]byte("^RSSI: 20\r\n"))
+			if i%10 == 0 {
+				client.handleDisconnect(errors.New("test"))
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		var stats struct {
+			ConnectionStats ConnectionStats `json:"connection_stats"`
+		}
+		getJSON(t, s, "/api/stats", &stats)
+	}
+	<-done
+
+	var stats struct {
+		ConnectionStats ConnectionStats `json:"connection_stats"`
+	}
+	getJSON(t, s, "/api/stats", &stats)
+	if got := stats.ConnectionStats.MessagesReceived; got != 100 {
+		t.Errorf("messages_received = %d, want 100", got)
+	}
+	if stats.ConnectionStats.LastDisconnect.IsZero() {
+		t.Error("last_disconnect not reported")
+	}
+}
+
+func TestHealthAPI(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	s := newTestServer(t, client)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			client.modemStatus.mu.Lock()
+			client.modemStatus.IsConnected = true
+			client.modemStatus.mu.Unlock()
+			client.handleDisconnect(errors.New("test"))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		var health map[string]any
+		getJSON(t, s, "/api/health", &health)
+	}
+	<-done
+
+	var health struct {
+		Status      string `json:"status"`
+		IsConnected bool   `json:"is_connected"`
+	}
+	getJSON(t, s, "/api/health", &health)
+	if health.Status != "disconnected" || health.IsConnected {
+		t.Errorf("health = %+v, want disconnected", health)
+	}
+}
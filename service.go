@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ServiceState is the registration picture from ^SYSINFOEX, ^SYSINFO, ^MODE,
+// ^SRVST and ^SIMST
+type ServiceState struct {
+	Status     string    `json:"status"`
+	Domain     string    `json:"domain"`
+	Roaming    bool      `json:"roaming"`
+	SIMState   string    `json:"sim_state"`
+	SysMode    string    `json:"sysmode"`
+	SubMode    string    `json:"submode,omitempty"`
+	Source     string    `json:"source"`
+	LastUpdate time.Time `json:"last_update"`
+}
+
+// Service status names (<srv_status>)
+var serviceStatuses = map[int]string{
+	0: "no service",
+	1: "limited service",
+	2: "valid service",
+	3: "limited regional service",
+	4: "power saving",
+}
+
+// Service domain names (<srv_domain>)
+var serviceDomains = map[int]string{
+	0:   "no service",
+	1:   "CS only",
+	2:   "PS only",
+	3:   "CS+PS",
+	4:   "searching",
+	255: "not supported",
+}
+
+// SIM state names (<sim_state>)
+var simStates = map[int]string{
+	0:   "invalid",
+	1:   "valid",
+	2:   "invalid for CS",
+	3:   "invalid for PS",
+	4:   "invalid for CS and PS",
+	240: "ROMSIM",
+	255: "not present",
+}
+
+// sysinfoModes names the <sys_mode> of ^SYSINFO and ^MODE
+var sysinfoModes = map[int]string{
+	0: "NO SERVICE", 1: "AMPS", 2: "CDMA", 3: "GSM", 4: "HDR", 5: "WCDMA",
+	6: "GPS", 7: "GSM/WCDMA", 8: "CDMA/HDR", 9: "TD-SCDMA", 17: "LTE",
+}
+
+// sysinfoSubModes names the <sys_submode> of ^SYSINFO and ^MODE
+var sysinfoSubModes = map[int]string{
+	0: "NO SERVICE", 1: "GSM", 2: "GPRS", 3: "EDGE", 4: "WCDMA", 5: "HSDPA",
+	6: "HSUPA", 7: "HSPA", 8: "TD-SCDMA", 9: "HSPA+", 17: "HSPA+ (64QAM)",
+	18: "HSPA+ (MIMO)", 101: "LTE",
+}
+
+var (
+	sysinfoexRegex = regexp.MustCompile(`\^SYSINFOEX:\s*(\d+),(\d+),(\d+),(\d+),(\d*),(\d+),"([^"]*)",(\d+),"([^"]*)"`)
+	sysinfoRegex   = regexp.MustCompile(`\^SYSINFO:\s*(\d+),(\d+),(\d+),(\d+),(\d+)(?:,(\d*)(?:,(\d+))?)?`)
+	modeRegex      = regexp.MustCompile(`\^MODE:\s*(\d+)(?:,(\d+))?`)
+)
+
+func init() {
+	registerURCParser("^SYSINFO:", parseSYSINFO)
+	registerURCParser("^MODE:", parseMODE)
+}
+
+// codeName looks a code up in a name table, falling back to the number
+func codeName(names map[int]string, field string) string {
+	code, err := strconv.Atoi(field)
+	if err != nil {
+		return ""
+	}
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return "unknown (" + field + ")"
+}
+
+// ServiceReport updates the service state. Nil fields and an empty SysMode
+// are left unchanged, since ^MODE, ^SRVST and ^SIMST carry only part of it.
+type ServiceReport struct {
+	Command  string
+	Status   *string
+	Domain   *string
+	Roaming  *bool
+	SIMState *string
+	SysMode  string
+	SubMode  string
+}
+
+// parseSYSINFOEX decodes ^SYSINFOEX: <srv_status>,<srv_domain>,<roam_status>,
+// <sim_state>,<lock_state>,<sysmode>,<sysmode_name>,<submode>,<submode_name>
+func parseSYSINFOEX(line string) (urcResult, error) {
+	m := sysinfoexRegex.FindStringSubmatch(line)
+	if len(m) != 10 {
+		return nil, fmt.Errorf("malformed ^SYSINFOEX: %q", line)
+	}
+	status := codeName(serviceStatuses, m[1])
+	domain := codeName(serviceDomains, m[2])
+	roaming := m[3] == "1"
+	sim := codeName(simStates, m[4])
+	return ServiceReport{
+		Command:  "^SYSINFOEX",
+		Status:   &status,
+		Domain:   &domain,
+		Roaming:  &roaming,
+		SIMState: &sim,
+		SysMode:  m[7],
+		SubMode:  m[9],
+	}, nil
+}
+
+// parseSYSINFO decodes ^SYSINFO: <srv_status>,<srv_domain>,<roam_status>,
+// <sys_mode>,<sim_state>[,<lock_state>,<sys_submode>]
+func parseSYSINFO(line string) (urcResult, error) {
+	m := sysinfoRegex.FindStringSubmatch(line)
+	if len(m) != 8 {
+		return nil, fmt.Errorf("malformed ^SYSINFO: %q", line)
+	}
+	status := codeName(serviceStatuses, m[1])
+	domain := codeName(serviceDomains, m[2])
+	roaming := m[3] == "1"
+	sim := codeName(simStates, m[5])
+	report := ServiceReport{
+		Command:  "^SYSINFO",
+		Status:   &status,
+		Domain:   &domain,
+		Roaming:  &roaming,
+		SIMState: &sim,
+		SysMode:  codeName(sysinfoModes, m[4]),
+	}
+	if m[7] != "" {
+		report.SubMode = codeName(sysinfoSubModes, m[7])
+	}
+	return report, nil
+}
+
+// parseMODE decodes ^MODE: <sys_mode>[,<sys_submode>]
+func parseMODE(line string) (urcResult, error) {
+	m := modeRegex.FindStringSubmatch(line)
+	if len(m) != 3 {
+		return nil, fmt.Errorf("malformed ^MODE: %q", line)
+	}
+	report := ServiceReport{Command: "^MODE", SysMode: codeName(sysinfoModes, m[1])}
+	if m[2] != "" {
+		report.SubMode = codeName(sysinfoSubModes, m[2])
+	}
+	return report, nil
+}
+
+func (r ServiceReport) apply(w *WebSocketClient) {
+	w.modemStatus.mu.Lock()
+	s := &w.modemStatus.Service
+	prev := *s
+	if r.Status != nil {
+		s.Status = *r.Status
+	}
+	if r.Domain != nil {
+		s.Domain = *r.Domain
+	}
+	if r.Roaming != nil {
+		s.Roaming = *r.Roaming
+	}
+	if r.SIMState != nil {
+		s.SIMState = *r.SIMState
+	}
+	if r.SysMode != "" {
+		s.SysMode = r.SysMode
+		s.SubMode = r.SubMode
+	}
+	s.Source = r.Command
+	s.LastUpdate = time.Now()
+	if r.SysMode != "" {
+		w.modemStatus.NetworkType = r.SysMode
+	}
+	state := *s
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+
+	switch r.Command {
+	case "^SYSINFOEX", "^SYSINFO":
+		w.markRefreshed("sysinfoex")
+	}
+	w.logger.Printf("INFO: Service updated (%s): %s, domain %s, roaming %t, SIM %s, mode %s %s",
+		r.Command, state.Status, state.Domain, state.Roaming, state.SIMState, state.SysMode, state.SubMode)
+
+	// The first report of a run only establishes the state
+	if prev.SIMState != "" && state.SIMState != prev.SIMState {
+		message := "SIM " + state.SIMState
+		switch {
+		case state.SIMState == simStates[255]:
+			message = "SIM removed"
+		case prev.SIMState == simStates[255]:
+			message = "SIM inserted, " + state.SIMState
+		}
+		w.recordEvent(eventSIM, message, map[string]string{
+			"from": prev.SIMState, "to": state.SIMState, "source": r.Command,
+		})
+	}
+	if prev.Status != "" && state.Status != prev.Status {
+		w.recordEvent(eventService, fmt.Sprintf("Service changed from %s to %s", prev.Status, state.Status),
+			map[string]string{"from": prev.Status, "to": state.Status, "source": r.Command})
+	}
+}
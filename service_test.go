@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseServiceReports(t *testing.T) {
+	str := func(s string) *string { return &s }
+	yes, no := true, false
+
+	tests := []struct {
+		parse   func(string) (urcResult, error)
+		line    string
+		want    ServiceReport
+		wantErr bool
+	}{
+		{
+			parse: parseSYSINFOEX,
+			line:  `^SYSINFOEX:2,3,0,1,,6,"LTE",101,"LTE"`,
+			want: ServiceReport{Command: "^SYSINFOEX", Status: str("valid service"), Domain: str("CS+PS"),
+				Roaming: &no, SIMState: str("valid"), SysMode: "LTE", SubMode: "LTE"},
+		},
+		{
+			parse: parseSYSINFOEX,
+			line:  `^SYSINFOEX: 1,2,1,255,0,3,"WCDMA",41,"HSPA+"`,
+			want: ServiceReport{Command: "^SYSINFOEX", Status: str("limited service"), Domain: str("PS only"),
+				Roaming: &yes, SIMState: str("not present"), SysMode: "WCDMA", SubMode: "HSPA+"},
+		},
+		{
+			parse: parseSYSINFOEX,
+			line:  `^SYSINFOEX:7,3,0,1,,6,"LTE",101,"LTE"`,
+			want: ServiceReport{Command: "^SYSINFOEX", Status: str("unknown (7)"), Domain: str("CS+PS"),
+				Roaming: &no, SIMState: str("valid"), SysMode: "LTE", SubMode: "LTE"},
+		},
+		{parse: parseSYSINFOEX, line: `^SYSINFOEX:2,3,0,1,,6,"LTE"`, wantErr: true},
+		{parse: parseSYSINFOEX, line: `^SYSINFOEX:2,3,0,1,,6,LTE,101,LTE`, wantErr: true},
+		{parse: parseSYSINFOEX, line: `^SYSINFOEX:`, wantErr: true},
+		{
+			parse: parseSYSINFO,
+			line:  `^SYSINFO:2,3,0,5,1,,4`,
+			want: ServiceReport{Command: "^SYSINFO", Status: str("valid service"), Domain: str("CS+PS"),
+				Roaming: &no, SIMState: str("valid"), SysMode: "WCDMA", SubMode: "WCDMA"},
+		},
+		{
+			parse: parseSYSINFO,
+			line:  `^SYSINFO:0,0,0,0,255`,
+			want: ServiceReport{Command: "^SYSINFO", Status: str("no service"), Domain: str("no service"),
+				Roaming: &no, SIMState: str("not present"), SysMode: "NO SERVICE"},
+		},
+		{parse: parseSYSINFO, line: `^SYSINFO:2,3,0`, wantErr: true},
+		{parse: parseMODE, line: `^MODE:17,101`, want: ServiceReport{Command: "^MODE", SysMode: "LTE", SubMode: "LTE"}},
+		{parse: parseMODE, line: `^MODE: 5`, want: ServiceReport{Command: "^MODE", SysMode: "WCDMA"}},
+		{parse: parseMODE, line: `^MODE:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.parse(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parse(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse(%q) = %s, want %s", tt.line, describeServiceReport(got), describeServiceReport(tt.want))
+		}
+	}
+}
+
+func describeServiceReport(result urcResult) string {
+	r, ok := result.(ServiceReport)
+	if !ok {
+		return fmt.Sprintf("%T", result)
+	}
+	deref := func(s *string) any {
+		if s == nil {
+			return nil
+		}
+		return *s
+	}
+	var roaming any
+	if r.Roaming != nil {
+		roaming = *r.Roaming
+	}
+	return fmt.Sprintf("%s status %v, domain %v, roaming %v, SIM %v, mode %s/%s",
+		r.Command, deref(r.Status), deref(r.Domain), roaming, deref(r.SIMState), r.SysMode, r.SubMode)
+}
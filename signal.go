@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// hcsqUnknown is the ^HCSQ index for a value that is not known or not
+// detectable
+const hcsqUnknown = 255
+
+// csqUnknown is the ^RSSI and +CSQ index for an unknown signal level
+const csqUnknown = 99
+
+// Signal levels decoded from a ^HCSQ report. Absent values are nil.
+type signalLevels struct {
+	RSSI *float64
+	RSCP *float64
+	ECIO *float64
+	RSRQ *float64
+	RSRP *float64
+	SINR *float64
+}
+
+// hcsqLevel converts a ^HCSQ index to real units. Index 1 is the lower edge
+// of the range, so the value is base + step*index.
+func hcsqLevel(index int, base, step float64) *float64 {
+	if index == hcsqUnknown || index < 0 {
+		return nil
+	}
+	v := math.Round((base+step*float64(index))*10) / 10
+	return &v
+}
+
+// csqLevel converts the 0-31 ^RSSI/+CSQ index to dBm
+func csqLevel(index int) *float64 {
+	if index == csqUnknown || index < 0 || index > 31 {
+		return nil
+	}
+	v := float64(-113 + 2*index)
+	return &v
+}
+
+// decodeHCSQ decodes the values of a ^HCSQ report for its system mode. The
+// layouts and formulas are those of the Huawei AT command reference:
+//
+//	LTE:   rssi,rsrp,sinr,rsrq
+//	WCDMA: rssi,rscp,ecio
+//	GSM:   rssi
+func decodeHCSQ(sysMode string, values []int) (signalLevels, error) {
+	var levels signalLevels
+	want := map[string]int{"NOSERVICE": 0, "GSM": 1, "WCDMA": 3, "TD-SCDMA": 3, "LTE": 4}
+	n, ok := want[sysMode]
+	if !ok {
+		return levels, fmt.Errorf("unknown ^HCSQ sysmode %q", sysMode)
+	}
+	if len(values) < n {
+		return levels, fmt.Errorf("^HCSQ %s needs %d values, got %d", sysMode, n, len(values))
+	}
+
+	switch sysMode {
+	case "GSM":
+		levels.RSSI = hcsqLevel(values[0], -121, 1)
+	case "WCDMA", "TD-SCDMA":
+		levels.RSSI = hcsqLevel(values[0], -121, 1)
+		levels.RSCP = hcsqLevel(values[1], -121, 1)
+		levels.ECIO = hcsqLevel(values[2], -32.5, 0.5)
+	case "LTE":
+		levels.RSSI = hcsqLevel(values[0], -121, 1)
+		levels.RSRP = hcsqLevel(values[1], -141, 1)
+		levels.SINR = hcsqLevel(values[2], -20.2, 0.2)
+		levels.RSRQ = hcsqLevel(values[3], -20, 0.5)
+	}
+	return levels, nil
+}
+
+// parseHCSQValues splits the numeric fields after the quoted sysmode
+func parseHCSQValues(fields string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ^HCSQ value %q", field)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// formatLevel renders an optional level for logs
+func formatLevel(v *float64) string {
+	if v == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
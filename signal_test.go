@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// dBm returns a pointer to a decoded level
+func dBm(v float64) *float64 { return &v }
+
+func TestDecodeHCSQ(t *testing.T) {
+	tests := []struct {
+		sysMode string
+		values  []int
+		want    signalLevels
+		wantErr bool
+	}{
+		{sysMode: "NOSERVICE"},
+		{sysMode: "GSM", values: []int{50}, want: signalLevels{RSSI: dBm(-71)}},
+		{sysMode: "GSM", values: []int{255}, want: signalLevels{}},
+		{
+			sysMode: "WCDMA",
+			values:  []int{30, 31, 40},
+			want:    signalLevels{RSSI: dBm(-91), RSCP: dBm(-90), ECIO: dBm(-12.5)},
+		},
+		{
+			sysMode: "TD-SCDMA",
+			values:  []int{30, 255, 0},
+			want:    signalLevels{RSSI: dBm(-91), ECIO: dBm(-32.5)},
+		},
+		{
+			sysMode: "LTE",
+			values:  []int{50, 40, 100, 20},
+			want:    signalLevels{RSSI: dBm(-71), RSRP: dBm(-101), SINR: dBm(-0.2), RSRQ: dBm(-10)},
+		},
+		{
+			sysMode: "LTE",
+			values:  []int{50, 255, 251, 255},
+			want:    signalLevels{RSSI: dBm(-71), SINR: dBm(30)},
+		},
+		{sysMode: "LTE", values: []int{255, 255, 255, 255}, want: signalLevels{}},
+		{sysMode: "LTE", values: []int{50, 40}, wantErr: true},
+		{sysMode: "WCDMA", values: []int{30}, wantErr: true},
+		{sysMode: "CDMA", values: []int{30}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := decodeHCSQ(tt.sysMode, tt.values)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("decodeHCSQ(%q, %v) = %+v, want an error", tt.sysMode, tt.values, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeHCSQ(%q, %v): %v", tt.sysMode, tt.values, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeHCSQ(%q, %v) = %s, want %s", tt.sysMode, tt.values, formatLevels(got), formatLevels(tt.want))
+		}
+	}
+}
+
+func TestParseHCSQ(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    HCSQReport
+		wantErr bool
+	}{
+		{
+			line: `^HCSQ:"LTE",50,40,100,20`,
+			want: HCSQReport{SysMode: "LTE", Levels: signalLevels{RSSI: dBm(-71), RSRP: dBm(-101), SINR: dBm(-0.2), RSRQ: dBm(-10)}},
+		},
+		{
+			line: `^HCSQ: "WCDMA", 30, 31, 40`,
+			want: HCSQReport{SysMode: "WCDMA", Levels: signalLevels{RSSI: dBm(-91), RSCP: dBm(-90), ECIO: dBm(-12.5)}},
+		},
+		{line: `^HCSQ:"NOSERVICE"`, want: HCSQReport{SysMode: "NOSERVICE"}},
+		{line: `^HCSQ:"LTE",50`, wantErr: true},
+		{line: `^HCSQ:LTE,50,40,100,20`, wantErr: true},
+		{line: `^HCSQ:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHCSQ(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHCSQ(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHCSQ(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHCSQ(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCSQLevel(t *testing.T) {
+	tests := []struct {
+		index int
+		want  *float64
+	}{
+		{0, dBm(-113)},
+		{20, dBm(-73)},
+		{31, dBm(-51)},
+		{32, nil},
+		{99, nil},
+		{-1, nil},
+	}
+	for _, tt := range tests {
+		if got := csqLevel(tt.index); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("csqLevel(%d) = %s, want %s", tt.index, formatLevel(got), formatLevel(tt.want))
+		}
+	}
+}
+
+func formatLevels(l signalLevels) string {
+	return "RSSI " + formatLevel(l.RSSI) + ", RSCP " + formatLevel(l.RSCP) + ", EcIo " + formatLevel(l.ECIO) +
+		", RSRP " + formatLevel(l.RSRP) + ", RSRQ " + formatLevel(l.RSRQ) + ", SINR " + formatLevel(l.SINR)
+}
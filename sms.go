@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMSMessage is a received message, reassembled from its parts
+type SMSMessage struct {
+	ID       int       `json:"id"`
+	From     string    `json:"from"`
+	SMSC     string    `json:"smsc,omitempty"`
+	Time     time.Time `json:"time"`
+	Received time.Time `json:"received"`
+	Encoding string    `json:"encoding"`
+	Text     string    `json:"text"`
+	Parts    int       `json:"parts"`
+	Complete bool      `json:"complete"`
+	Read     bool      `json:"read"`
+	// Storage holds the modem storage indexes of the parts; messages
+	// delivered directly with +CMT have none
+	Storage []int `json:"storage,omitempty"`
+
+	ref   int
+	texts map[int]string // part text by sequence number
+}
+
+// smsInbox keeps the messages received by a modem
+type smsInbox struct {
+	mu       sync.Mutex
+	nextID   int
+	messages []*SMSMessage
+	byIndex  map[int]*SMSMessage // by storage index
+}
+
+// add files a decoded part under its message. index is the storage index or
+// -1. It returns a copy of the message and whether this part completed it.
+func (in *smsInbox) add(part *smsDeliver, index int, read bool) (SMSMessage, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.byIndex == nil {
+		in.byIndex = make(map[int]*SMSMessage)
+	}
+	if msg, ok := in.byIndex[index]; ok && index >= 0 {
+		if msg.From == part.From && msg.hasPart(part) {
+			// Seen on an earlier listing
+			msg.Read = msg.Read || read
+			return msg.copy(), false
+		}
+		// The slot was freed and reused behind our back
+		in.dropIndex(msg, index)
+	}
+
+	var msg *SMSMessage
+	if part.Parts > 1 {
+		for _, m := range in.messages {
+			if !m.Complete && m.From == part.From && m.ref == part.Ref && m.Parts == part.Parts {
+				msg = m
+				break
+			}
+		}
+	}
+	if msg == nil {
+		in.nextID++
+		msg = &SMSMessage{
+			ID:       in.nextID,
+			From:     part.From,
+			SMSC:     part.SMSC,
+			Received: time.Now(),
+			Encoding: part.Encoding,
+			Parts:    1,
+			ref:      part.Ref,
+			texts:    make(map[int]string),
+		}
+		if part.Parts > 1 {
+			msg.Parts = part.Parts
+		}
+		in.messages = append(in.messages, msg)
+	}
+
+	seq := part.Seq
+	if part.Parts <= 1 {
+		seq = 1
+	}
+	if seq == 1 || msg.Time.IsZero() {
+		msg.Time = part.Time
+	}
+	if part.Encoding != msg.Encoding {
+		msg.Encoding = "mixed"
+	}
+	msg.texts[seq] = part.Text
+	msg.Read = msg.Read || read
+	if index >= 0 {
+		msg.Storage = append(msg.Storage, index)
+		in.byIndex[index] = msg
+	}
+
+	wasComplete := msg.Complete
+	msg.Complete = len(msg.texts) == msg.Parts
+	msg.join()
+	return msg.copy(), msg.Complete && !wasComplete
+}
+
+func (m *SMSMessage) hasPart(part *smsDeliver) bool {
+	seq := part.Seq
+	if part.Parts <= 1 {
+		seq = 1
+	}
+	text, ok := m.texts[seq]
+	return ok && text == part.Text
+}
+
+// join rebuilds the text from the parts received so far
+func (m *SMSMessage) join() {
+	var b strings.Builder
+	for seq := 1; seq <= m.Parts; seq++ {
+		if text, ok := m.texts[seq]; ok {
+			b.WriteString(text)
+		} else {
+			b.WriteString("[…]")
+		}
+	}
+	m.Text = b.String()
+}
+
+func (m *SMSMessage) copy() SMSMessage {
+	c := *m
+	c.Storage = append([]int(nil), m.Storage...)
+	c.texts = nil
+	return c
+}
+
+// dropIndex forgets a storage index, and the message once it has no parts left
+func (in *smsInbox) dropIndex(msg *SMSMessage, index int) {
+	delete(in.byIndex, index)
+	for i, idx := range msg.Storage {
+		if idx == index {
+			msg.Storage = append(msg.Storage[:i], msg.Storage[i+1:]...)
+			break
+		}
+	}
+	if len(msg.Storage) == 0 {
+		in.remove(msg.ID)
+	}
+}
+
+func (in *smsInbox) remove(id int) {
+	for i, m := range in.messages {
+		if m.ID == id {
+			in.messages = append(in.messages[:i], in.messages[i+1:]...)
+			for _, index := range m.Storage {
+				delete(in.byIndex, index)
+			}
+			return
+		}
+	}
+}
+
+// get returns a message, marking it read when markRead is set
+func (in *smsInbox) get(id int, markRead bool) (SMSMessage, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for _, m := range in.messages {
+		if m.ID == id {
+			if markRead {
+				m.Read = true
+			}
+			return m.copy(), true
+		}
+	}
+	return SMSMessage{}, false
+}
+
+// list returns the messages, newest first
+func (in *smsInbox) list() []SMSMessage {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	messages := make([]SMSMessage, 0, len(in.messages))
+	for _, m := range in.messages {
+		messages = append(messages, m.copy())
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Time.After(messages[j].Time)
+	})
+	return messages
+}
+
+func init() {
+	registerURCParser("+CMTI:", parseCMTI)
+	registerURCParser("+CMT:", parseCMT)
+	// Listings are read from the SendAT response by readSMS and syncSMS
+	registerURCParser("+CMGR:", ignoreLine)
+	registerURCParser("+CMGL:", ignoreLine)
+}
+
+func ignoreLine(line string) (urcResult, error) {
+	return ignoredResult{}, nil
+}
+
+// cmtiRegex matches +CMTI: "<mem>",<index>
+var cmtiRegex = regexp.MustCompile(`\+CMTI:\s*"([^"]*)",\s*(\d+)`)
+
+// SMSIndication is a +CMTI notice that a message was stored
+type SMSIndication struct {
+	Memory string
+	Index  int
+}
+
+func parseCMTI(line string) (urcResult, error) {
+	m := cmtiRegex.FindStringSubmatch(line)
+	if len(m) != 3 {
+		return nil, fmt.Errorf("malformed +CMTI: %q", line)
+	}
+	index, _ := strconv.Atoi(m[2])
+	return SMSIndication{Memory: m[1], Index: index}, nil
+}
+
+func (r SMSIndication) apply(w *WebSocketClient) {
+	w.logger.Printf("INFO: New SMS stored in %s at index %d", r.Memory, r.Index)
+	// Reading needs the line loop that is delivering this notice
+	go func() {
+		if err := w.readSMS(context.Background(), r.Index); err != nil {
+			w.logger.Printf("WARN: Failed to read SMS %d: %v", r.Index, err)
+		}
+	}()
+}
+
+// SMSDelivery is a message delivered with +CMT instead of being stored
+type SMSDelivery struct {
+	Part *smsDeliver
+}
+
+// parseCMT decodes +CMT: [<alpha>],<length> joined by the framer with the
+// PDU that follows it
+func parseCMT(line string) (urcResult, error) {
+	_, pdu, ok := strings.Cut(line, "\n")
+	if !ok {
+		return nil, fmt.Errorf("+CMT without PDU: %q", line)
+	}
+	part, err := decodeDeliverPDU(pdu)
+	if err != nil {
+		return nil, fmt.Errorf("+CMT: %v", err)
+	}
+	return SMSDelivery{Part: part}, nil
+}
+
+func (r SMSDelivery) apply(w *WebSocketClient) {
+	w.addSMS(r.Part, -1, false)
+}
+
+// smsListEntry is one message of a +CMGR or +CMGL response
+type smsListEntry struct {
+	Index int
+	Read  bool
+	PDU   string
+}
+
+// SMS storage states of +CMGR/+CMGL in PDU mode
+const (
+	smsRecUnread = 0
+	smsRecRead   = 1
+)
+
+// parseSMSListing decodes +CMGR/+CMGL headers, each joined by the framer
+// with its PDU. +CMGR has no index of its own; index is used instead.
+//
+//	+CMGL: <index>,<stat>,[<alpha>],<length>
+//	+CMGR: <stat>,[<alpha>],<length>
+func parseSMSListing(lines []string, index int) ([]smsListEntry, error) {
+	var entries []smsListEntry
+	for _, line := range lines {
+		header, pdu, hasPDU := strings.Cut(line, "\n")
+		prefix, body, _ := strings.Cut(header, ":")
+		if prefix != "+CMGL" && prefix != "+CMGR" {
+			continue
+		}
+		if !hasPDU {
+			return entries, fmt.Errorf("%s without PDU", prefix)
+		}
+		f := splitATFields(strings.TrimSpace(body))
+		entry := smsListEntry{Index: index, PDU: pdu}
+		if prefix == "+CMGL" {
+			n, err := strconv.Atoi(f[0])
+			if err != nil || len(f) < 2 {
+				return entries, fmt.Errorf("malformed +CMGL: %q", header)
+			}
+			entry.Index, f = n, f[1:]
+		}
+		stat, err := strconv.Atoi(f[0])
+		if err != nil {
+			return entries, fmt.Errorf("malformed %s: %q", prefix, header)
+		}
+		if stat != smsRecUnread && stat != smsRecRead {
+			// Stored outgoing messages
+			continue
+		}
+		entry.Read = stat == smsRecRead
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readSMS fetches the message at a storage index
+func (w *WebSocketClient) readSMS(ctx context.Context, index int) error {
+	if _, err := w.SendAT(ctx, "AT+CMGF=0"); err != nil {
+		return err
+	}
+	lines, err := w.SendAT(ctx, fmt.Sprintf("AT+CMGR=%d", index))
+	if err != nil {
+		return err
+	}
+	return w.addSMSListing(lines, index)
+}
+
+// syncSMS reads every message in storage, e.g. after a reconnect
+func (w *WebSocketClient) syncSMS(ctx context.Context) error {
+	if _, err := w.SendAT(ctx, "AT+CMGF=0"); err != nil {
+		return err
+	}
+	lines, err := w.SendAT(ctx, "AT+CMGL=4")
+	if err != nil {
+		return err
+	}
+	return w.addSMSListing(lines, -1)
+}
+
+func (w *WebSocketClient) addSMSListing(lines []string, index int) error {
+	entries, err := parseSMSListing(lines, index)
+	for _, entry := range entries {
+		part, err := decodeDeliverPDU(entry.PDU)
+		if err != nil {
+			w.logger.Printf("WARN: SMS %d: %v", entry.Index, err)
+			continue
+		}
+		w.addSMS(part, entry.Index, entry.Read)
+	}
+	return err
+}
+
+// addSMS files a decoded part and records an event once the message is complete
+func (w *WebSocketClient) addSMS(part *smsDeliver, index int, read bool) {
+	msg, completed := w.sms.add(part, index, read)
+	if !completed {
+		return
+	}
+	w.recordEvent(eventSMS, fmt.Sprintf("SMS from %s", msg.From), map[string]string{
+		"id":    strconv.Itoa(msg.ID),
+		"from":  msg.From,
+		"parts": strconv.Itoa(msg.Parts),
+	})
+}
+
+// SMS returns the inbox, newest first
+func (w *WebSocketClient) SMS() []SMSMessage {
+	return w.sms.list()
+}
+
+// deleteSMS removes a message from the modem's storage and from the inbox
+func (w *WebSocketClient) deleteSMS(ctx context.Context, id int) error {
+	msg, ok := w.sms.get(id, false)
+	if !ok {
+		return errSMSNotFound
+	}
+	for _, index := range msg.Storage {
+		if _, err := w.SendAT(ctx, fmt.Sprintf("AT+CMGD=%d", index)); err != nil {
+			return fmt.Errorf("failed to delete SMS %d at index %d: %w", id, index, err)
+		}
+	}
+
+	w.sms.mu.Lock()
+	w.sms.remove(id)
+	w.sms.mu.Unlock()
+	return nil
+}
+
+var errSMSNotFound = errors.New("no such message")
+
+func (s *Server) handleSMSListAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Client.SMS())
+}
+
+func (s *Server) handleSMSReadAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	id, err := strconv.Atoi(r.PathValue("sms"))
+	if err != nil {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+	msg, ok := m.Client.sms.get(id, true)
+	if !ok {
+		http.Error(w, errSMSNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+func (s *Server) handleSMSDeleteAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	id, err := strconv.Atoi(r.PathValue("sms"))
+	if err != nil {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+
+	switch err := m.Client.deleteSMS(r.Context(), id); {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errSMSNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// smsMaxParts bounds how many parts one API request may send
+const smsMaxParts = 10
+
+func init() {
+	// Read from the SendATData response by sendSMS
+	registerURCParser("+CMGS:", ignoreLine)
+}
+
+// cmgsRegex matches +CMGS: <mr>
+var cmgsRegex = regexp.MustCompile(`\+CMGS:\s*(\d+)`)
+
+// smsSendRequest is the body of POST /api/sms/send
+type smsSendRequest struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// smsSendResponse is returned by POST /api/sms/send. References holds the
+// message reference of every part the network accepted.
+type smsSendResponse struct {
+	To         string `json:"to"`
+	Encoding   string `json:"encoding"`
+	Parts      int    `json:"parts"`
+	References []int  `json:"references"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	CMSError   *int   `json:"cms_error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// smsPlan is an outgoing message encoded into PDUs
+type smsPlan struct {
+	Encoding string
+	PDUs     []string
+	Lengths  []int // TPDU length of each PDU for AT+CMGS
+}
+
+// planSMS encodes text for to, splitting it into concatenated parts
+func (w *WebSocketClient) planSMS(to, text string) (*smsPlan, error) {
+	encoding, parts := splitSMS(text)
+	if len(parts) > smsMaxParts {
+		return nil, fmt.Errorf("text needs %d parts, at most %d are allowed", len(parts), smsMaxParts)
+	}
+
+	plan := &smsPlan{Encoding: encoding}
+	ref := int(atomic.AddUint32(&w.smsRef, 1) & 0xFF)
+	for i, part := range parts {
+		pdu, length, err := encodeSubmitPDU(to, encoding, part, ref, i+1, len(parts))
+		if err != nil {
+			return nil, err
+		}
+		plan.PDUs = append(plan.PDUs, pdu)
+		plan.Lengths = append(plan.Lengths, length)
+	}
+	return plan, nil
+}
+
+// sendSMS submits the parts in order with AT+CMGS and returns the message
+// references of those that were accepted. Each command gets the full AT
+// timeout of its own.
+func (w *WebSocketClient) sendSMS(ctx context.Context, plan *smsPlan) ([]int, error) {
+	cmgfCtx, cancel := context.WithTimeout(ctx, w.config.ATTimeout)
+	_, err := w.SendAT(cmgfCtx, "AT+CMGF=0")
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []int{}
+	for i, pdu := range plan.PDUs {
+		partCtx, cancel := context.WithTimeout(ctx, w.config.ATTimeout)
+		lines, err := w.SendATData(partCtx, fmt.Sprintf("AT+CMGS=%d", plan.Lengths[i]), pdu)
+		cancel()
+		if err != nil {
+			return refs, fmt.Errorf("part %d of %d: %w", i+1, len(plan.PDUs), err)
+		}
+		ref := -1
+		for _, line := range lines {
+			if m := cmgsRegex.FindStringSubmatch(line); m != nil {
+				ref, _ = strconv.Atoi(m[1])
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func (s *Server) handleSMSSendAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	var req smsSendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16384)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.To = strings.Join(strings.Fields(req.To), "")
+	if req.To == "" || req.Text == "" {
+		http.Error(w, "to and text are required", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := m.Client.planSMS(req.To, req.Text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := smsSendResponse{
+		To:         req.To,
+		Encoding:   plan.Encoding,
+		Parts:      len(plan.PDUs),
+		References: []int{},
+	}
+	code := http.StatusOK
+	start := time.Now()
+
+	command := "AT+CMGS"
+	if err := s.atPolicy.Check(command); err != nil {
+		resp.Status = "denied"
+		resp.Error = err.Error()
+		code = http.StatusForbidden
+	} else {
+		// AT+CMGF and every part are bounded by the AT timeout, so the
+		// response may be due long after the server's WriteTimeout
+		budget := time.Duration(len(plan.PDUs)+1) * s.config.ATTimeout
+		s.extendWriteDeadline(w, budget)
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		refs, err := m.Client.sendSMS(ctx, plan)
+		cancel()
+
+		resp.References = append(resp.References, refs...)
+		resp.Status, code = atStatus(err)
+		if err != nil {
+			resp.Error = err.Error()
+			var cms *CMSError
+			if errors.As(err, &cms) && cms.Code >= 0 {
+				resp.CMSError = &cms.Code
+			}
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+
+	s.atAudit.Record(atAuditRecord{
+		Time:       start,
+		Modem:      m.ID,
+		Remote:     r.RemoteAddr,
+		Command:    fmt.Sprintf("%s (SMS to %s, %d parts)", command, req.To, resp.Parts),
+		Status:     resp.Status,
+		Error:      resp.Error,
+		DurationMs: resp.DurationMs,
+	})
+	if resp.Status == "ok" {
+		m.Client.recordEvent(eventSMSSent, fmt.Sprintf("SMS sent to %s", req.To), map[string]string{
+			"to":    req.To,
+			"parts": strconv.Itoa(resp.Parts),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
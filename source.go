@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// ModemSource abstracts the transport used to reach the modem. The client owns
+// the reconnect loop and all parsing; a source only moves frames in and out.
+type ModemSource interface {
+	// Connect establishes the underlying transport
+	Connect(ctx context.Context) error
+	// ReadFrame blocks until the next chunk of modem output is available
+	ReadFrame() ([]byte, error)
+	// WriteFrame sends raw data (usually an AT command) to the modem
+	WriteFrame(data []byte) error
+	// Close tears down the transport and unblocks a pending ReadFrame.
+	// A closed source may be connected again.
+	Close() error
+	// String describes the source for logging
+	String() string
+}
+
+// reportSource is implemented by sources that have no AT output and decode
+// the modem's state themselves. The client reads reports instead of frames
+// from them.
+type reportSource interface {
+	// ReadReport blocks until the next decoded report is available
+	ReadReport() (urcResult, error)
+}
+
+// newModemSource builds the source selected by config.Source
+func newModemSource(config *Config, logger *log.Logger) (ModemSource, error) {
+	switch config.Source {
+	case "", "websocket":
+		return newWebSocketSource(config, logger), nil
+	case "serial":
+		return newSerialSource(config, logger)
+	case "hilink":
+		return newHiLinkSource(config, logger), nil
+	case "replay":
+		return newReplaySource(config, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown modem source %q", config.Source)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// urcResult is the typed outcome of parsing one line. apply folds it into
+// the client's state.
+type urcResult interface {
+	apply(w *WebSocketClient)
+}
+
+// urcParseFunc decodes a line starting with the parser's prefix
+type urcParseFunc func(line string) (urcResult, error)
+
+// unhandledURC is the stats key of lines no parser claimed
+const unhandledURC = "unhandled"
+
+// urcParsers maps a line prefix such as "^RSSI:" to its parser. It is filled
+// by registerURCParser from init functions and read-only afterwards.
+var urcParsers = map[string]urcParseFunc{}
+
+// registerURCParser adds a parser for lines starting with prefix, which
+// includes the trailing colon
+func registerURCParser(prefix string, parse urcParseFunc) {
+	if _, dup := urcParsers[prefix]; dup {
+		panic("duplicate URC parser for " + prefix)
+	}
+	urcParsers[prefix] = parse
+}
+
+func init() {
+	registerURCParser("^RSSI:", parseRSSI)
+	registerURCParser("+CSQ:", parseCSQ)
+	registerURCParser("^HCSQ:", parseHCSQ)
+	registerURCParser("^DSFLOWRPT:", parseDSFLOW)
+	registerURCParser("^DSFLOWQRY:", parseDSFLOWQRY)
+	registerURCParser("^SYSINFOEX:", parseSYSINFOEX)
+}
+
+// ParserStats counts the lines a parser was given and how many it rejected
+type ParserStats struct {
+	Hits   int64 `json:"hits"`
+	Errors int64 `json:"errors"`
+}
+
+// newParserStats creates a counter for every registered parser
+func newParserStats() map[string]*ParserStats {
+	stats := make(map[string]*ParserStats, len(urcParsers)+1)
+	for prefix := range urcParsers {
+		stats[strings.TrimSuffix(prefix, ":")] = &ParserStats{}
+	}
+	stats[unhandledURC] = &ParserStats{}
+	return stats
+}
+
+// ParserStats returns a snapshot of the per-parser counters
+func (w *WebSocketClient) ParserStats() map[string]ParserStats {
+	snapshot := make(map[string]ParserStats, len(w.parserStats))
+	for name, stats := range w.parserStats {
+		snapshot[name] = ParserStats{
+			Hits:   atomic.LoadInt64(&stats.Hits),
+			Errors: atomic.LoadInt64(&stats.Errors),
+		}
+	}
+	return snapshot
+}
+
+// handleLine dispatches one logical line
+func (w *WebSocketClient) handleLine(line string) {
+	w.routeResponse(line)
+
+	prefix, _, ok := strings.Cut(line, ":")
+	if !ok || prefix == "" || !strings.ContainsAny(prefix[:1], "+^") {
+		return
+	}
+	if done, _ := finalResult(line); done {
+		return
+	}
+
+	parse, ok := urcParsers[prefix+":"]
+	if !ok {
+		w.handleUnknownURC(prefix, line)
+		return
+	}
+
+	stats := w.parserStats[prefix]
+	atomic.AddInt64(&stats.Hits, 1)
+	result, err := parse(line)
+	if err != nil {
+		atomic.AddInt64(&stats.Errors, 1)
+		w.logger.Printf("WARN: %v", err)
+		return
+	}
+	result.apply(w)
+}
+
+// handleUnknownURC is the fallback for prefixed lines no parser claimed
+func (w *WebSocketClient) handleUnknownURC(prefix, line string) {
+	atomic.AddInt64(&w.parserStats[unhandledURC].Hits, 1)
+	w.logger.Printf("DEBUG: No parser for %s: %q", prefix, line)
+}
+
+// RSSIReport is ^RSSI or +CSQ converted to dBm, nil when unknown
+type RSSIReport struct {
+	RSSI *float64
+}
+
+func parseRSSI(line string) (urcResult, error) {
+	matches := rssiRegex.FindStringSubmatch(line)
+	if len(matches) != 2 {
+		return nil, fmt.Errorf("malformed ^RSSI: %q", line)
+	}
+	rssi, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ^RSSI: %q", line)
+	}
+	return RSSIReport{RSSI: csqLevel(rssi)}, nil
+}
+
+func parseCSQ(line string) (urcResult, error) {
+	matches := csqRegex.FindStringSubmatch(line)
+	if len(matches) != 3 {
+		return nil, fmt.Errorf("malformed +CSQ: %q", line)
+	}
+	rssi, _ := strconv.Atoi(matches[1])
+	return RSSIReport{RSSI: csqLevel(rssi)}, nil
+}
+
+func (r RSSIReport) apply(w *WebSocketClient) {
+	w.modemStatus.mu.Lock()
+	w.modemStatus.RSSI = r.RSSI
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+	w.markRefreshed("csq")
+	w.logger.Printf("INFO: RSSI updated: %s dBm", formatLevel(r.RSSI))
+}
+
+// HCSQReport is ^HCSQ decoded for its system mode
+type HCSQReport struct {
+	SysMode string
+	Levels  signalLevels
+}
+
+func parseHCSQ(line string) (urcResult, error) {
+	matches := hcsqRegex.FindStringSubmatch(line)
+	if len(matches) != 3 {
+		return nil, fmt.Errorf("malformed ^HCSQ: %q", line)
+	}
+	values, err := parseHCSQValues(matches[2])
+	if err != nil {
+		return nil, err
+	}
+	levels, err := decodeHCSQ(matches[1], values)
+	if err != nil {
+		return nil, err
+	}
+	return HCSQReport{SysMode: matches[1], Levels: levels}, nil
+}
+
+func (r HCSQReport) apply(w *WebSocketClient) {
+	l := r.Levels
+
+	// Values the new mode does not report are cleared, not kept stale
+	w.modemStatus.mu.Lock()
+	w.modemStatus.NetworkType = r.SysMode
+	w.modemStatus.RSSI = l.RSSI
+	w.modemStatus.RSCP = l.RSCP
+	w.modemStatus.ECIO = l.ECIO
+	w.modemStatus.RSRQ = l.RSRQ
+	w.modemStatus.RSRP = l.RSRP
+	w.modemStatus.SINR = l.SINR
+	w.modemStatus.LastUpdate = time.Now()
+	w.modemStatus.mu.Unlock()
+	w.markRefreshed("hcsq")
+
+	w.logger.Printf("INFO: Network updated: %s, RSSI: %s, RSCP: %s, Ec/Io: %s, RSRP: %s, RSRQ: %s, SINR: %s",
+		r.SysMode, formatLevel(l.RSSI), formatLevel(l.RSCP), formatLevel(l.ECIO),
+		formatLevel(l.RSRP), formatLevel(l.RSRQ), formatLevel(l.SINR))
+}
+
+// DataFlowReport is a ^DSFLOWRPT report or ^DSFLOWQRY reply
+type DataFlowReport struct {
+	Record DataFlowRecord
+}
+
+// parseHex decodes one of the hexadecimal ^DSFLOW fields
+func parseHex(field string) int64 {
+	v, _ := strconv.ParseInt(strings.TrimSpace(field), 16, 64)
+	return v
+}
+
+// parseDSFLOW decodes ^DSFLOWRPT: <curr_ds_time>,<tx_rate>,<rx_rate>,
+// <curr_tx_flow>,<curr_rx_flow>,<qos_tx_rate>,<qos_rx_rate>
+func parseDSFLOW(line string) (urcResult, error) {
+	matches := dsflowRegex.FindStringSubmatch(line)
+	if len(matches) != 8 {
+		return nil, fmt.Errorf("malformed ^DSFLOWRPT: %q", line)
+	}
+	return DataFlowReport{Record: DataFlowRecord{
+		Timestamp: time.Now(),
+		Source:    "dsflowrpt",
+		Duration:  parseHex(matches[1]),
+		ULRate:    parseHex(matches[2]),
+		DLRate:    parseHex(matches[3]),
+		ULBytes:   parseHex(matches[4]),
+		DLBytes:   parseHex(matches[5]),
+		QoSULRate: parseHex(matches[6]),
+		QoSDLRate: parseHex(matches[7]),
+	}}, nil
+}
+
+// parseDSFLOWQRY decodes ^DSFLOWQRY: <last_ds_time>,<last_tx_flow>,
+// <last_rx_flow>,<total_ds_time>,<total_tx_flow>,<total_rx_flow>
+func parseDSFLOWQRY(line string) (urcResult, error) {
+	matches := dsflowQryRegex.FindStringSubmatch(line)
+	if len(matches) != 7 {
+		return nil, fmt.Errorf("malformed ^DSFLOWQRY: %q", line)
+	}
+	return DataFlowReport{Record: DataFlowRecord{
+		Timestamp: time.Now(),
+		Source:    "dsflowqry",
+		Duration:  parseHex(matches[1]),
+		ULBytes:   parseHex(matches[2]),
+		DLBytes:   parseHex(matches[3]),
+		TotalUL:   parseHex(matches[5]),
+		TotalDL:   parseHex(matches[6]),
+	}}, nil
+}
+
+func (r DataFlowReport) apply(w *WebSocketClient) {
+	record := w.recordDataFlow(r.Record)
+	w.markRefreshed("dsflow")
+
+	w.logger.Printf("DEBUG: Data flow - UL: %d B/s, DL: %d B/s, Session UL: %d, Session DL: %d",
+		record.ULRate, record.DLRate, record.ULBytes, record.DLBytes)
+}
+
+// recordDataFlow appends a record to the flow history. When the modem does
+// not report rates, they are derived from the byte counts of the previous
+// record of the same session.
+func (w *WebSocketClient) recordDataFlow(record DataFlowRecord) DataFlowRecord {
+	w.modemStatus.mu.Lock()
+	defer w.modemStatus.mu.Unlock()
+
+	if n := len(w.modemStatus.DataFlow); n > 0 && record.ULRate == 0 && record.DLRate == 0 {
+		prev := w.modemStatus.DataFlow[n-1]
+		elapsed := record.Timestamp.Sub(prev.Timestamp).Seconds()
+		sameSession := record.Duration >= prev.Duration &&
+			record.ULBytes >= prev.ULBytes && record.DLBytes >= prev.DLBytes
+		if elapsed > 0 && sameSession {
+			record.ULRate = int64(float64(record.ULBytes-prev.ULBytes) / elapsed)
+			record.DLRate = int64(float64(record.DLBytes-prev.DLBytes) / elapsed)
+			record.RatesDerived = true
+		}
+	}
+
+	// Keep only last 100 records
+	if len(w.modemStatus.DataFlow) >= 100 {
+		w.modemStatus.DataFlow = w.modemStatus.DataFlow[1:]
+	}
+	w.modemStatus.DataFlow = append(w.modemStatus.DataFlow, record)
+	w.modemStatus.LastUpdate = time.Now()
+	return record
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleLineIgnoresNonURCs(t *testing.T) {
+	client, err := NewWebSocketClient(&Config{}, &ModemStatus{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{":", ": 1,2", "OK", "no colon", "COPS: 0"} {
+		client.handleLine(line)
+	}
+	if hits := client.ParserStats()[unhandledURC].Hits; hits != 0 {
+		t.Errorf("%d lines counted as unhandled URCs, want 0", hits)
+	}
+}
+
+func TestParseDSFLOW(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    DataFlowRecord
+		wantErr bool
+	}{
+		{
+			line: "^DSFLOWRPT:0000003C,00000100,00000200,0000000000001000,0000000000002000,0003E800,0007D000",
+			want: DataFlowRecord{Source: "dsflowrpt", Duration: 60, ULRate: 256, DLRate: 512,
+				ULBytes: 4096, DLBytes: 8192, QoSULRate: 256000, QoSDLRate: 512000},
+		},
+		{
+			line: "^DSFLOWRPT: 00000000,00000000,00000000,0000000000000000,0000000000000000,00000000,00000000",
+			want: DataFlowRecord{Source: "dsflowrpt"},
+		},
+		{
+			line: "^DSFLOWQRY:0000003E,0000000000001800,0000000000003000,00000100,0000000000010000,0000000000020000",
+			want: DataFlowRecord{Source: "dsflowqry", Duration: 62, ULBytes: 6144, DLBytes: 12288,
+				TotalUL: 65536, TotalDL: 131072},
+		},
+		{line: "^DSFLOWRPT:0000003C,00000100,00000200", wantErr: true},
+		{line: "^DSFLOWRPT:", wantErr: true},
+		{line: "^DSFLOWQRY:0000003E,0000000000001800", wantErr: true},
+	}
+	for _, tt := range tests {
+		parse := parseDSFLOW
+		if strings.HasPrefix(tt.line, "^DSFLOWQRY:") {
+			parse = parseDSFLOWQRY
+		}
+		result, err := parse(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parse(%q) = %+v, want an error", tt.line, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.line, err)
+			continue
+		}
+		got := result.(DataFlowReport).Record
+		got.Timestamp = time.Time{}
+		if got != tt.want {
+			t.Errorf("parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRecordDataFlowDerivesRates(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := DataFlowRecord{Timestamp: start, Duration: 60, ULBytes: 4096, DLBytes: 8192}
+	tests := []struct {
+		name        string
+		prev        *DataFlowRecord
+		record      DataFlowRecord
+		wantUL      int64
+		wantDL      int64
+		wantDerived bool
+	}{
+		{
+			name:   "no previous record",
+			record: DataFlowRecord{Timestamp: start, Duration: 60, ULBytes: 4096, DLBytes: 8192},
+		},
+		{
+			name:        "0/0 reported",
+			prev:        &prev,
+			record:      DataFlowRecord{Timestamp: start.Add(2 * time.Second), Duration: 62, ULBytes: 6144, DLBytes: 12288},
+			wantUL:      1024,
+			wantDL:      2048,
+			wantDerived: true,
+		},
+		{
+			name:   "rates reported",
+			prev:   &prev,
+			record: DataFlowRecord{Timestamp: start.Add(2 * time.Second), Duration: 62, ULBytes: 6144, DLBytes: 12288, ULRate: 10, DLRate: 20},
+			wantUL: 10,
+			wantDL: 20,
+		},
+		{
+			name:   "new session",
+			prev:   &prev,
+			record: DataFlowRecord{Timestamp: start.Add(2 * time.Second), Duration: 2, ULBytes: 100, DLBytes: 200},
+		},
+		{
+			name:   "same timestamp",
+			prev:   &prev,
+			record: DataFlowRecord{Timestamp: start, Duration: 60, ULBytes: 5000, DLBytes: 9000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewWebSocketClient(&Config{}, &ModemStatus{}, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prev != nil {
+				client.recordDataFlow(*tt.prev)
+			}
+			got := client.recordDataFlow(tt.record)
+			if got.ULRate != tt.wantUL || got.DLRate != tt.wantDL || got.RatesDerived != tt.wantDerived {
+				t.Errorf("rates = %d/%d derived %v, want %d/%d derived %v",
+					got.ULRate, got.DLRate, got.RatesDerived, tt.wantUL, tt.wantDL, tt.wantDerived)
+			}
+		})
+	}
+}
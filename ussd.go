@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ussdTimeout bounds the wait for the network's reply to a request
+const ussdTimeout = 30 * time.Second
+
+// ussdRetryDelay is how soon a failed scheduled query is tried again
+const ussdRetryDelay = 5 * time.Minute
+
+// ussdHistory is the number of results kept per scheduled query
+const ussdHistory = 365
+
+// ussdSessionIdle is how long an interactive session may wait for its next
+// menu answer before scheduled queries close it. Networks normally release
+// a session well before that.
+const ussdSessionIdle = 3 * time.Minute
+
+// ussdDCS is the data coding scheme of requests: GSM 7-bit, no language
+const ussdDCS = 15
+
+var (
+	errUSSDTimeout     = errors.New("no USSD reply from the network")
+	errUSSDSessionOpen = errors.New("a USSD session is open")
+)
+
+// ussdStatuses names the +CUSD <m>
+var ussdStatuses = map[int]string{
+	0: "done",
+	1: "action required",
+	2: "terminated by network",
+	3: "answered by other client",
+	4: "not supported",
+	5: "network timeout",
+}
+
+// USSDResponse is the network's reply to a USSD request
+type USSDResponse struct {
+	Time        time.Time `json:"time"`
+	Mode        int       `json:"mode"`
+	Status      string    `json:"status"`
+	Text        string    `json:"text"`
+	DCS         int       `json:"dcs"`
+	SessionOpen bool      `json:"session_open"`
+}
+
+// ussdQuery is a USSD code run on a schedule, from -ussd-query
+// "name=code@interval[|regex]". The first submatch of Pattern, or the first
+// number of the reply, is the value that gets graphed.
+type ussdQuery struct {
+	Name     string        `json:"name"`
+	Code     string        `json:"code"`
+	Interval time.Duration `json:"interval"`
+	Pattern  string        `json:"pattern,omitempty"`
+	pattern  *regexp.Regexp
+}
+
+// ussdQueryList collects repeated -ussd-query flags
+type ussdQueryList []ussdQuery
+
+func (l *ussdQueryList) String() string {
+	names := make([]string, 0, len(*l))
+	for _, q := range *l {
+		names = append(names, q.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *ussdQueryList) Set(value string) error {
+	spec, pattern, _ := strings.Cut(value, "|")
+	name, rest, ok := strings.Cut(spec, "=")
+	code, interval, ok2 := strings.Cut(rest, "@")
+	if !ok || !ok2 || strings.TrimSpace(name) == "" || strings.TrimSpace(code) == "" {
+		return fmt.Errorf("invalid USSD query %q (want name=code@interval[|regex])", value)
+	}
+	q := ussdQuery{Name: strings.TrimSpace(name), Code: strings.TrimSpace(code), Pattern: pattern}
+	d, err := time.ParseDuration(strings.TrimSpace(interval))
+	if err != nil || d < time.Minute {
+		return fmt.Errorf("invalid USSD query interval %q (at least 1m)", interval)
+	}
+	q.Interval = d
+	if pattern == "" {
+		pattern = `(-?\d+(?:[.,]\d+)?)`
+	}
+	if q.pattern, err = regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid USSD query pattern: %v", err)
+	}
+	for _, other := range *l {
+		if other.Name == q.Name {
+			return fmt.Errorf("duplicate USSD query %q", q.Name)
+		}
+	}
+	*l = append(*l, q)
+	return nil
+}
+
+// value extracts the number to graph from a reply
+func (q ussdQuery) value(text string) *float64 {
+	m := q.pattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+	number := m[0]
+	if len(m) > 1 {
+		number = m[1]
+	}
+	v, err := strconv.ParseFloat(strings.Replace(number, ",", ".", 1), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// USSDResult is one run of a scheduled query
+type USSDResult struct {
+	Time  time.Time `json:"time"`
+	Text  string    `json:"text,omitempty"`
+	Value *float64  `json:"value,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ussdState tracks the USSD session and the scheduled query results
+type ussdState struct {
+	slot chan struct{} // held by the request in flight
+
+	mu          sync.Mutex
+	waiter      chan USSDResponse
+	last        *USSDResponse
+	sessionOpen bool
+	sessionSeen time.Time // last reply of the open session
+	history     map[string][]USSDResult
+	lastRun     map[string]time.Time
+}
+
+func newUSSDState() *ussdState {
+	return &ussdState{
+		slot:    make(chan struct{}, 1),
+		history: make(map[string][]USSDResult),
+		lastRun: make(map[string]time.Time),
+	}
+}
+
+func init() {
+	registerURCParser("+CUSD:", parseCUSD)
+}
+
+// cusdRegex matches +CUSD: <m>[,"<str>"[,<dcs>]]; the string may span lines
+var cusdRegex = regexp.MustCompile(`(?s)\+CUSD:\s*(\d+)(?:,\s*"(.*)"(?:,\s*(\d+))?)?\s*$`)
+
+// USSDReport is a +CUSD reply, still encoded as the modem sent it
+type USSDReport struct {
+	Mode int
+	Raw  string
+	DCS  int
+}
+
+func parseCUSD(line string) (urcResult, error) {
+	m := cusdRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("malformed +CUSD: %q", line)
+	}
+	mode, _ := strconv.Atoi(m[1])
+	dcs := ussdDCS
+	if m[3] != "" {
+		dcs, _ = strconv.Atoi(m[3])
+	}
+	return USSDReport{Mode: mode, Raw: m[2], DCS: dcs}, nil
+}
+
+func (r USSDReport) apply(w *WebSocketClient) {
+	resp := USSDResponse{
+		Time:        time.Now(),
+		Mode:        r.Mode,
+		Status:      codeName(ussdStatuses, strconv.Itoa(r.Mode)),
+		Text:        decodeUSSD(r.Raw, r.DCS, w.config.USSDPacked),
+		DCS:         r.DCS,
+		SessionOpen: r.Mode == 1,
+	}
+
+	w.ussd.mu.Lock()
+	w.ussd.last = &resp
+	w.ussd.sessionOpen = resp.SessionOpen
+	w.ussd.sessionSeen = resp.Time
+	waiter := w.ussd.waiter
+	w.ussd.waiter = nil
+	w.ussd.mu.Unlock()
+
+	if waiter != nil {
+		waiter <- resp
+		return
+	}
+	// Network initiated, or the reply came after the request gave up
+	w.recordEvent(eventUSSD, "USSD: "+resp.Text, map[string]string{"status": resp.Status})
+}
+
+// ussdAlphabet maps a cell broadcast data coding scheme, which USSD uses,
+// to its alphabet
+func ussdAlphabet(dcs int) string {
+	switch {
+	case dcs == 0x11:
+		// UCS2 preceded by a language indication
+		return smsUCS2
+	case dcs&0xC0 == 0x40, dcs&0xF0 == 0xF0:
+		// General data coding, as in SMS
+		if alphabet, err := smsAlphabet(byte(dcs)); err == nil {
+			return alphabet
+		}
+	}
+	return smsGSM7
+}
+
+// decodeUSSD decodes a +CUSD string. UCS2 replies are always hex; GSM 7-bit
+// replies are packed hex only on modems that want packed requests.
+func decodeUSSD(raw string, dcs int, packed bool) string {
+	alphabet := ussdAlphabet(dcs)
+	if alphabet == smsGSM7 && !packed {
+		return raw
+	}
+	data, err := hex.DecodeString(raw)
+	if err != nil || len(data) == 0 {
+		// Already decoded by the modem
+		return raw
+	}
+
+	switch alphabet {
+	case smsUCS2:
+		if dcs == 0x11 && len(data) >= 2 {
+			data = data[2:]
+		}
+		return decodeUCS2(data)
+	case sms8Bit:
+		return string(data)
+	}
+	septets := unpackSeptets(data, len(data)*8/7)
+	// A CR fills the last septet when 7 bits would otherwise be left over
+	if len(data)*8%7 == 0 && len(septets) > 0 && septets[len(septets)-1] == '\r' {
+		septets = septets[:len(septets)-1]
+	}
+	return decodeGSM7(septets)
+}
+
+// encodeUSSD encodes a request for AT+CUSD, packed GSM 7-bit hex when the
+// modem wants it
+func encodeUSSD(code string, packed bool) (string, error) {
+	var septets []byte
+	for _, r := range code {
+		s, ok := gsm7Reverse[r]
+		if !ok || strings.ContainsRune("\"\r\n", r) {
+			return "", fmt.Errorf("character %q cannot be sent in USSD", r)
+		}
+		septets = append(septets, s...)
+	}
+	if !packed {
+		return code, nil
+	}
+	if len(septets)%8 == 7 {
+		septets = append(septets, '\r')
+	}
+	return strings.ToUpper(hex.EncodeToString(packSeptets(septets, 0))), nil
+}
+
+// sendUSSD sends a code and waits for the network's reply. With joinSession
+// the code may answer the open session's menu; otherwise an open session
+// fails the request with errUSSDSessionOpen.
+func (w *WebSocketClient) sendUSSD(ctx context.Context, code string, joinSession bool) (USSDResponse, error) {
+	encoded, err := encodeUSSD(code, w.config.USSDPacked)
+	if err != nil {
+		return USSDResponse{}, err
+	}
+
+	select {
+	case w.ussd.slot <- struct{}{}:
+		defer func() { <-w.ussd.slot }()
+	case <-ctx.Done():
+		return USSDResponse{}, errUSSDTimeout
+	}
+
+	// Register before sending; the reply may arrive ahead of the OK
+	reply := make(chan USSDResponse, 1)
+	w.ussd.mu.Lock()
+	if w.ussd.sessionOpen && !joinSession {
+		w.ussd.mu.Unlock()
+		return USSDResponse{}, errUSSDSessionOpen
+	}
+	w.ussd.waiter = reply
+	w.ussd.mu.Unlock()
+	defer func() {
+		w.ussd.mu.Lock()
+		if w.ussd.waiter == reply {
+			w.ussd.waiter = nil
+		}
+		w.ussd.mu.Unlock()
+	}()
+
+	if _, err := w.SendAT(ctx, fmt.Sprintf(`AT+CUSD=1,"%s",%d`, encoded, ussdDCS)); err != nil {
+		return USSDResponse{}, err
+	}
+
+	select {
+	case resp := <-reply:
+		return resp, nil
+	case <-ctx.Done():
+		return USSDResponse{}, errUSSDTimeout
+	}
+}
+
+// cancelUSSD ends the open session
+func (w *WebSocketClient) cancelUSSD(ctx context.Context) error {
+	if _, err := w.SendAT(ctx, "AT+CUSD=2"); err != nil {
+		return err
+	}
+	w.ussd.mu.Lock()
+	w.ussd.sessionOpen = false
+	w.ussd.mu.Unlock()
+	return nil
+}
+
+// runUSSDQueries runs the scheduled queries for one session and returns when
+// done is closed. Runs are remembered across sessions.
+func (w *WebSocketClient) runUSSDQueries(ctx context.Context, done <-chan struct{}) {
+	if len(w.config.USSDQueries) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(pollCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		// Leave an interactive session alone unless it was abandoned
+		w.ussd.mu.Lock()
+		open, idle := w.ussd.sessionOpen, time.Since(w.ussd.sessionSeen)
+		w.ussd.mu.Unlock()
+		if open {
+			if idle < ussdSessionIdle {
+				continue
+			}
+			w.logger.Printf("INFO: Closing USSD session idle for %v", idle.Round(time.Second))
+			cancelCtx, cancel := context.WithTimeout(ctx, w.config.ATTimeout)
+			err := w.cancelUSSD(cancelCtx)
+			cancel()
+			if err != nil {
+				w.logger.Printf("WARN: Failed to close idle USSD session: %v", err)
+				continue
+			}
+		}
+
+		for _, q := range w.config.USSDQueries {
+			w.ussd.mu.Lock()
+			lastRun := w.ussd.lastRun[q.Name]
+			w.ussd.mu.Unlock()
+			if time.Since(lastRun) < q.Interval {
+				continue
+			}
+
+			queryCtx, cancel := context.WithTimeout(ctx, ussdTimeout)
+			resp, err := w.sendUSSD(queryCtx, q.Code, false)
+			cancel()
+			if errors.Is(err, errReadOnlySource) {
+				w.logger.Printf("INFO: Scheduled USSD queries disabled: %v", err)
+				return
+			}
+			if errors.Is(err, errUSSDSessionOpen) {
+				// Opened from the API meanwhile; try again on a later tick
+				break
+			}
+			if resp.SessionOpen || errors.Is(err, errUSSDTimeout) {
+				// Nobody will answer the menu, and a late reply may open one;
+				// close it so that it does not swallow the next request
+				cancelCtx, cancel := context.WithTimeout(ctx, w.config.ATTimeout)
+				if err := w.cancelUSSD(cancelCtx); err != nil {
+					w.logger.Printf("WARN: Failed to close USSD session after query %s: %v", q.Name, err)
+				}
+				cancel()
+			}
+			w.recordUSSDResult(q, resp, err)
+		}
+	}
+}
+
+// recordUSSDResult adds a scheduled query's result to its history
+func (w *WebSocketClient) recordUSSDResult(q ussdQuery, resp USSDResponse, err error) {
+	result := USSDResult{Time: time.Now()}
+	if err == nil && resp.Mode != 0 && resp.Mode != 2 {
+		err = fmt.Errorf("USSD %s", resp.Status)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		w.logger.Printf("WARN: USSD query %s failed: %v", q.Name, err)
+	} else {
+		result.Text = resp.Text
+		result.Value = q.value(resp.Text)
+		w.logger.Printf("INFO: USSD query %s: %q", q.Name, resp.Text)
+	}
+
+	w.ussd.mu.Lock()
+	defer w.ussd.mu.Unlock()
+
+	// Retry failures sooner than the interval, but do not hammer the network
+	w.ussd.lastRun[q.Name] = result.Time
+	if err != nil && q.Interval > ussdRetryDelay {
+		w.ussd.lastRun[q.Name] = result.Time.Add(ussdRetryDelay - q.Interval)
+	}
+	history := append(w.ussd.history[q.Name], result)
+	if len(history) > ussdHistory {
+		history = history[len(history)-ussdHistory:]
+	}
+	w.ussd.history[q.Name] = history
+}
+
+// ussdQueryState is a scheduled query with its results, oldest first
+type ussdQueryState struct {
+	ussdQuery
+	Results []USSDResult `json:"results"`
+}
+
+// USSDState is the session state and scheduled query history
+type USSDState struct {
+	SessionOpen bool             `json:"session_open"`
+	Last        *USSDResponse    `json:"last,omitempty"`
+	Queries     []ussdQueryState `json:"queries"`
+}
+
+// USSDState returns a snapshot of the USSD state
+func (w *WebSocketClient) USSDState() USSDState {
+	w.ussd.mu.Lock()
+	defer w.ussd.mu.Unlock()
+
+	state := USSDState{SessionOpen: w.ussd.sessionOpen, Last: w.ussd.last, Queries: []ussdQueryState{}}
+	for _, q := range w.config.USSDQueries {
+		results := append([]USSDResult{}, w.ussd.history[q.Name]...)
+		state.Queries = append(state.Queries, ussdQueryState{ussdQuery: q, Results: results})
+	}
+	return state
+}
+
+// ussdRequest is the body of POST /api/ussd
+type ussdRequest struct {
+	Code string `json:"code"`
+}
+
+// ussdAPIResponse is returned by POST and DELETE /api/ussd
+type ussdAPIResponse struct {
+	Code        string `json:"code,omitempty"`
+	Status      string `json:"status"`
+	Text        string `json:"text,omitempty"`
+	SessionOpen bool   `json:"session_open"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+func (s *Server) handleUSSDStateAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Client.USSDState())
+}
+
+func (s *Server) handleUSSDAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	var req ussdRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	s.runUSSDRequest(w, r, m, req.Code, func(ctx context.Context) (USSDResponse, error) {
+		return m.Client.sendUSSD(ctx, req.Code, true)
+	})
+}
+
+func (s *Server) handleUSSDCancelAPI(w http.ResponseWriter, r *http.Request, m *Modem) {
+	s.runUSSDRequest(w, r, m, "", func(ctx context.Context) (USSDResponse, error) {
+		return USSDResponse{Status: "cancelled"}, m.Client.cancelUSSD(ctx)
+	})
+}
+
+// runUSSDRequest applies the AT policy and audit trail to a USSD API call
+func (s *Server) runUSSDRequest(w http.ResponseWriter, r *http.Request, m *Modem, code string,
+	run func(ctx context.Context) (USSDResponse, error)) {
+	resp := ussdAPIResponse{Code: code}
+	httpCode := http.StatusOK
+	start := time.Now()
+
+	command := "AT+CUSD=1"
+	if code == "" {
+		command = "AT+CUSD=2"
+	}
+	if err := s.atPolicy.Check(command); err != nil {
+		resp.Status = "denied"
+		resp.Error = err.Error()
+		httpCode = http.StatusForbidden
+	} else {
+		// The network may take a while, often longer than the server's
+		// WriteTimeout
+		s.extendWriteDeadline(w, ussdTimeout)
+		ctx, cancel := context.WithTimeout(r.Context(), ussdTimeout)
+		reply, err := run(ctx)
+		cancel()
+
+		switch {
+		case err == nil:
+			resp.Status, resp.Text, resp.SessionOpen = reply.Status, reply.Text, reply.SessionOpen
+		case errors.Is(err, errUSSDTimeout):
+			resp.Status, httpCode = "timeout", http.StatusGatewayTimeout
+		default:
+			resp.Status, httpCode = atStatus(err)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	resp.DurationMs = time.Since(start).Milliseconds()
+
+	s.atAudit.Record(atAuditRecord{
+		Time:       start,
+		Modem:      m.ID,
+		Remote:     r.RemoteAddr,
+		Command:    strings.TrimSpace(command + " " + code),
+		Status:     resp.Status,
+		Error:      resp.Error,
+		DurationMs: resp.DurationMs,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEncodeUSSD(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		packed  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "unpacked", code: "*100#", want: "*100#"},
+		{name: "packed", code: "*100#", packed: true, want: "AA180C3602"},
+		{name: "packed, CR pads 7 spare bits", code: "*101*1#", packed: true, want: "AA182CA68A8D1A"},
+		{name: "packed, whole octets", code: "*100*12#", packed: true, want: "AA180CA68AC946"},
+		{name: "quote", code: `*100"#`, wantErr: true},
+		{name: "line break", code: "*100\r#", wantErr: true},
+		{name: "outside GSM 7-bit", code: "*100*ж#", packed: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeUSSD(tt.code, tt.packed)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("encodeUSSD(%q) = %q, want an error", tt.code, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("encodeUSSD(%q) = %q, %v, want %q", tt.code, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeUSSD(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		dcs    int
+		packed bool
+		want   string
+	}{
+		{name: "unpacked text", raw: "Balance 10.50", dcs: 15, want: "Balance 10.50"},
+		{name: "unpacked hex-like text", raw: "1234", dcs: 15, want: "1234"},
+		{name: "packed", raw: "C2303BEC1E97413198AB0603", dcs: 15, packed: true, want: "Balance 10.50"},
+		{name: "packed, CR padding dropped", raw: "AA182CA68A8D1A", dcs: 15, packed: true, want: "*101*1#"},
+		{name: "packed, whole octets", raw: "AA180CA68AC946", dcs: 15, packed: true, want: "*100*12#"},
+		{name: "packed modem sends text", raw: "Balance 10.50", dcs: 15, packed: true, want: "Balance 10.50"},
+		{name: "UCS2", raw: "04110430043B0430043D0441", dcs: 72, want: "Баланс"},
+		{name: "UCS2, packed modem", raw: "04110430043B0430043D0441", dcs: 72, packed: true, want: "Баланс"},
+		{name: "UCS2 with language", raw: "656E00480069", dcs: 0x11, want: "Hi"},
+		{name: "8-bit", raw: "4869", dcs: 0x44, want: "Hi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeUSSD(tt.raw, tt.dcs, tt.packed); got != tt.want {
+				t.Errorf("decodeUSSD(%q, %d, %t) = %q, want %q", tt.raw, tt.dcs, tt.packed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUSSDRoundTrip(t *testing.T) {
+	for _, code := range []string{"*100#", "*101*1#", "*100*12#", "*100*12345#", "#102#"} {
+		encoded, err := encodeUSSD(code, true)
+		if err != nil {
+			t.Fatalf("encodeUSSD(%q): %v", code, err)
+		}
+		if got := decodeUSSD(encoded, ussdDCS, true); got != code {
+			t.Errorf("decodeUSSD(encodeUSSD(%q)) = %q", code, got)
+		}
+	}
+}
+
+func TestParseCUSD(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    USSDReport
+		wantErr bool
+	}{
+		{line: `+CUSD: 0,"Balance 10.50",15`, want: USSDReport{Mode: 0, Raw: "Balance 10.50", DCS: 15}},
+		{line: `+CUSD: 1,"04110430043B0430043D0441",72`, want: USSDReport{Mode: 1, Raw: "04110430043B0430043D0441", DCS: 72}},
+		{
+			line: "+CUSD: 1,\"1. Balance\n2. Tariff\n3. Exit\",15",
+			want: USSDReport{Mode: 1, Raw: "1. Balance\n2. Tariff\n3. Exit", DCS: 15},
+		},
+		{line: `+CUSD: 0,"Menu, options"`, want: USSDReport{Mode: 0, Raw: "Menu, options", DCS: ussdDCS}},
+		{line: `+CUSD: 2`, want: USSDReport{Mode: 2, DCS: ussdDCS}},
+		{line: `+CUSD:4`, want: USSDReport{Mode: 4, DCS: ussdDCS}},
+		{line: `+CUSD: x`, wantErr: true},
+		{line: `+CUSD: 0,"unterminated`, wantErr: true},
+		{line: `+CUSD:`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCUSD(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCUSD(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCUSD(%q): %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCUSD(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScheduledUSSDWaitsForSession(t *testing.T) {
+	client, source := newTestClient(t, func(command string) []string {
+		switch command {
+		case "AT+CUSD=2\r":
+			return []string{"OK\r\n"}
+		case "AT+CUSD=1,\"*100#\",15\r":
+			return []string{"OK\r\n", "+CUSD: 0,\"Balance 10.50\",15\r\n"}
+		}
+		return []string{"ERROR\r\n"}
+	})
+	var queries ussdQueryList
+	if err := queries.Set("balance=*100#@1h"); err != nil {
+		t.Fatal(err)
+	}
+	client.config.USSDQueries = queries
+
+	// A menu answer from the API is allowed, a scheduled query is not
+	client.ussd.sessionOpen, client.ussd.sessionSeen = true, time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.sendUSSD(ctx, "*100#", false); err != errUSSDSessionOpen {
+		t.Fatalf("sendUSSD() into an open session = %v, want errUSSDSessionOpen", err)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		client.runUSSDQueries(context.Background(), done)
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	select {
+	case command := <-source.written:
+		t.Fatalf("%q sent during an active session", command)
+	case <-time.After(pollCheckInterval + 300*time.Millisecond):
+	}
+
+	// An abandoned session is closed before the query runs
+	client.ussd.mu.Lock()
+	client.ussd.sessionSeen = time.Now().Add(-ussdSessionIdle)
+	client.ussd.mu.Unlock()
+	for _, want := range []string{"AT+CUSD=2\r", "AT+CUSD=1,\"*100#\",15\r"} {
+		select {
+		case command := <-source.written:
+			if command != want {
+				t.Fatalf("sent %q, want %q", command, want)
+			}
+		case <-time.After(2 * pollCheckInterval):
+			t.Fatalf("%q not sent", want)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		state := client.USSDState()
+		if results := state.Queries[0].Results; len(results) == 1 {
+			if results[0].Value == nil || *results[0].Value != 10.5 {
+				t.Errorf("result = %+v, want 10.5", results[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no result recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -4,70 +4,108 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"sync/atomic"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
-func NewWebSocketClient(config *Config, modemStatus *ModemStatus, logger *log.Logger) *WebSocketClient {
+func NewWebSocketClient(config *Config, modemStatus *ModemStatus, logger *log.Logger) (*WebSocketClient, error) {
+	if err := validateReconnectPolicy(config.ReconnectPolicy); err != nil {
+		return nil, err
+	}
+
+	var pollJobs []pollJob
+	if config.ActivePoll {
+		jobs, err := parsePollSchedule(config.PollCommands)
+		if err != nil {
+			return nil, err
+		}
+		pollJobs = jobs
+	}
+
+	source, err := newModemSource(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	return &WebSocketClient{
 		config:      config,
 		modemStatus: modemStatus,
+		source:      source,
 		shutdown:    make(chan struct{}),
 		reconnect:   make(chan struct{}, 1),
+		cmdSlot:     make(chan struct{}, 1),
+		ussd:        newUSSDState(),
 		stats:       &ConnectionStats{},
 		logger:      logger,
-	}
+		pollJobs:    pollJobs,
+		parserStats: newParserStats(),
+	}, nil
 }
 
-func (w *WebSocketClient) Start(ctx context.Context) {
-	w.logger.Println("Starting WebSocket client")
+// Start runs the connect/reconnect loop until the client is stopped. It
+// returns an error only when the exit policy gives up on the modem.
+func (w *WebSocketClient) Start(ctx context.Context) error {
+	w.logger.Println("Starting modem client")
 
 	for {
 		select {
 		case <-ctx.Done():
-			w.logger.Println("WebSocket client stopping due to context cancellation")
-			return
+			w.logger.Println("Modem client stopping due to context cancellation")
+			w.setReconnectState(stateStopped, time.Time{})
+			return nil
 		case <-w.shutdown:
-			w.logger.Println("WebSocket client stopping")
-			return
+			w.logger.Println("Modem client stopping")
+			w.setReconnectState(stateStopped, time.Time{})
+			return nil
 		default:
-			if err := w.connectAndListen(ctx); err != nil {
-				w.logger.Printf("WebSocket connection error: %v", err)
-			}
+		}
 
-			// Check if we should reconnect
-			if w.config.MaxReconnect > 0 && w.reconnectCount >= w.config.MaxReconnect {
-				w.logger.Printf("Max reconnection attempts (%d) reached", w.config.MaxReconnect)
-				return
-			}
+		w.setReconnectState(stateConnecting, time.Time{})
+		w.sessionStart = time.Time{}
+		err := w.connectAndListen(ctx)
+		if err != nil {
+			w.logger.Printf("Modem connection error: %v", err)
+			w.recordReconnectError(err)
+		}
+
+		attempt := w.nextAttempt(w.sessionStart)
+
+		// Check if we should give up
+		if w.config.ReconnectPolicy == ReconnectExit &&
+			w.config.MaxReconnect > 0 && attempt > w.config.MaxReconnect {
+			w.logger.Printf("Max reconnection attempts (%d) reached", w.config.MaxReconnect)
+			w.setReconnectState(stateFailed, time.Time{})
+			return fmt.Errorf("gave up after %d reconnection attempts: %v", w.config.MaxReconnect, err)
+		}
 
-			w.logger.Printf("Reconnecting in %v...", w.config.ReconnectDelay)
-			time.Sleep(w.config.ReconnectDelay)
-			w.reconnectCount++
+		delay := backoffDelay(w.config.ReconnectDelay, w.config.ReconnectMaxDelay, attempt)
+		w.setReconnectState(stateWaiting, time.Now().Add(delay))
+		w.logger.Printf("Reconnecting in %v (attempt %d)...", delay.Round(time.Millisecond), attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-w.shutdown:
+		case <-timer.C:
 		}
+		timer.Stop()
 	}
 }
 
 func (w *WebSocketClient) connectAndListen(ctx context.Context) error {
-	dialer := websocket.Dialer{
-		HandshakeTimeout: w.config.RequestTimeout,
+	if err := w.source.Connect(ctx); err != nil {
+		return err
 	}
+	defer w.source.Close()
 
-	conn, _, err := dialer.Dial(w.config.ModemWSURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to connect to WebSocket: %v", err)
-	}
-	defer conn.Close()
-
-	w.conn = conn
-	w.reconnectCount = 0
+	w.recorder.StartSession(w.source)
+	w.resetFramer()
+	w.sessionStart = time.Now()
+	w.setReconnectState(stateConnected, time.Time{})
 	atomic.AddInt64(&w.stats.TotalReconnects, 1)
 
-	w.logger.Println("Successfully connected to modem WebSocket")
+	w.logger.Printf("Successfully connected to modem via %s", w.source)
+	w.recordEvent(eventConnection, fmt.Sprintf("Connected via %s", w.source), nil)
 
 	// Update modem status
 	w.modemStatus.mu.Lock()
@@ -75,8 +113,20 @@ func (w *WebSocketClient) connectAndListen(ctx context.Context) error {
 	w.modemStatus.LastUpdate = time.Now()
 	w.modemStatus.mu.Unlock()
 
-	// Start ping goroutine
-	go w.pingHandler(ctx)
+	// Bring the modem into a known state before polling it
+	w.setInitState(InitState{State: initPending})
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
+	go func() {
+		if err := w.runInit(ctx, sessionDone); err != nil {
+			w.logger.Printf("WARN: %v", err)
+		}
+		go w.runUSSDQueries(ctx, sessionDone)
+		if err := w.syncSMS(ctx); err != nil {
+			w.logger.Printf("DEBUG: SMS inbox not read: %v", err)
+		}
+		w.runPoller(ctx, sessionDone)
+	}()
 
 	// Listen for messages
 	for {
@@ -86,147 +136,120 @@ func (w *WebSocketClient) connectAndListen(ctx context.Context) error {
 		case <-w.shutdown:
 			return nil
 		default:
-			conn.SetReadDeadline(time.Now().Add(w.config.PingInterval * 2))
-			messageType, message, err := conn.ReadMessage()
-			if err != nil {
-				w.handleDisconnect()
-				return fmt.Errorf("WebSocket read error: %v", err)
-			}
-			//log.Printf("message: %s", message)
-			if messageType == websocket.TextMessage {
-				w.handleMessage(message)
+			if err := w.readNext(); err != nil {
+				w.handleDisconnect(err)
+				return err
 			}
 		}
 	}
 }
 
-func (w *WebSocketClient) handleMessage(message []byte) {
-	atomic.AddInt64(&w.stats.BytesReceived, int64(len(message)))
-	atomic.AddInt64(&w.stats.MessagesReceived, 1)
-
-	messageStr := string(message)
-	w.logger.Printf("DEBUG: Received message: %s", messageStr)
-
-	for _, str := range strings.Fields(messageStr) {
-		//s := strings.TrimSpace(str)
-		// Parse different message types
-		if strings.HasPrefix(str, "^RSSI:") {
-			w.parseRSSI(str)
-		} else if strings.HasPrefix(str, "^HCSQ:") {
-			w.parseHCSQ(str)
-		} else if strings.HasPrefix(str, "^DSFLOWRPT:") {
-			w.parseDSFLOW(str)
+// readNext handles the next frame from the source, or the next report from
+// sources that decode the modem's state themselves
+func (w *WebSocketClient) readNext() error {
+	if reports, ok := w.source.(reportSource); ok {
+		report, err := reports.ReadReport()
+		if err != nil {
+			return err
 		}
+		atomic.AddInt64(&w.stats.MessagesReceived, 1)
+		report.apply(w)
+		return nil
 	}
-}
 
-func (w *WebSocketClient) parseRSSI(data string) {
-	w.logger.Printf("DEBUG.parseRSSI string:%s", data)
-	matches := rssiRegex.FindStringSubmatch(data)
-	if len(matches) == 2 {
-		rssi, err := strconv.Atoi(matches[1])
-		if err == nil {
-			w.modemStatus.mu.Lock()
-			w.modemStatus.RSSI = rssi
-			w.modemStatus.LastUpdate = time.Now()
-			w.modemStatus.mu.Unlock()
-			w.logger.Printf("INFO: RSSI updated: %d", rssi)
-		}
+	message, err := w.source.ReadFrame()
+	if err != nil {
+		return err
 	}
+	//log.Printf("message: %s", message)
+	w.recorder.Frame(message)
+	w.handleMessage(message)
+	return nil
 }
 
-func (w *WebSocketClient) parseHCSQ(data string) {
-	matches := hcsqRegex.FindStringSubmatch(data)
-	if len(matches) == 6 {
-		networkType := matches[1]
-		signalStrength, _ := strconv.Atoi(matches[2])
-		signalQuality, _ := strconv.Atoi(matches[3])
-		rsrq, _ := strconv.Atoi(matches[4])
-		rsrp, _ := strconv.Atoi(matches[5])
-
-		w.modemStatus.mu.Lock()
-		w.modemStatus.NetworkType = networkType
-		w.modemStatus.SignalStrength = signalStrength
-		w.modemStatus.SignalQuality = signalQuality
-		w.modemStatus.RSRQ = rsrq
-		w.modemStatus.RSRP = rsrp
-		w.modemStatus.LastUpdate = time.Now()
-		w.modemStatus.mu.Unlock()
-
-		w.logger.Printf("INFO: Network updated: %s, Strength: %d, Quality: %d, RSRQ: %d, RSRP: %d",
-			networkType, signalStrength, signalQuality, rsrq, rsrp)
+func (w *WebSocketClient) handleMessage(message []byte) {
+	atomic.AddInt64(&w.stats.BytesReceived, int64(len(message)))
+	atomic.AddInt64(&w.stats.MessagesReceived, 1)
+
+	w.framerMu.Lock()
+	defer w.framerMu.Unlock()
+
+	for _, line := range w.framer.Feed(message) {
+		w.handleLine(line)
 	}
-}
 
-func (w *WebSocketClient) parseDSFLOW(data string) {
-	matches := dsflowRegex.FindStringSubmatch(data)
-	if len(matches) == 8 {
-		reportID := matches[1]
-		ulBytes, _ := strconv.ParseInt(matches[2], 16, 64)
-		dlBytes, _ := strconv.ParseInt(matches[3], 16, 64)
-		totalUL, _ := strconv.ParseInt(matches[4], 16, 64)
-		totalDL, _ := strconv.ParseInt(matches[5], 16, 64)
-
-		record := DataFlowRecord{
-			Timestamp: time.Now(),
-			ReportID:  reportID,
-			ULBytes:   ulBytes,
-			DLBytes:   dlBytes,
-			ULRate:    ulBytes, // This would need calculation based on time
-			DLRate:    dlBytes, // This would need calculation based on time
-			TotalUL:   totalUL,
-			TotalDL:   totalDL,
+	// Give the rest of a line split across frames a moment to arrive, then
+	// take what we have
+	if w.framer.Pending() {
+		if w.flushTimer == nil {
+			w.flushTimer = time.AfterFunc(partialLineTimeout, w.flushPartialLine)
+		} else {
+			w.flushTimer.Reset(partialLineTimeout)
 		}
+	}
+}
 
-		w.modemStatus.mu.Lock()
-		// Keep only last 100 records
-		if len(w.modemStatus.DataFlow) >= 100 {
-			w.modemStatus.DataFlow = w.modemStatus.DataFlow[1:]
-		}
-		w.modemStatus.DataFlow = append(w.modemStatus.DataFlow, record)
-		w.modemStatus.LastUpdate = time.Now()
-		w.modemStatus.mu.Unlock()
+func (w *WebSocketClient) flushPartialLine() {
+	w.framerMu.Lock()
+	defer w.framerMu.Unlock()
 
-		w.logger.Printf("DEBUG: Data flow - UL: %d, DL: %d, Total UL: %d, Total DL: %d",
-			ulBytes, dlBytes, totalUL, totalDL)
+	for _, line := range w.framer.Flush() {
+		w.handleLine(line)
 	}
 }
 
-func (w *WebSocketClient) pingHandler(ctx context.Context) {
-	ticker := time.NewTicker(w.config.PingInterval)
-	defer ticker.Stop()
+// resetFramer discards partial lines left over from a previous session
+func (w *WebSocketClient) resetFramer() {
+	w.framerMu.Lock()
+	defer w.framerMu.Unlock()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-w.shutdown:
-			return
-		case <-ticker.C:
-			if w.conn != nil {
-				err := w.conn.WriteMessage(websocket.PingMessage, nil)
-				if err != nil {
-					w.logger.Printf("Ping error: %v", err)
-					w.handleDisconnect()
-					return
-				}
-			}
-		}
+	w.framer.Reset()
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
 	}
 }
 
-func (w *WebSocketClient) handleDisconnect() {
+func (w *WebSocketClient) handleDisconnect(err error) {
 	w.modemStatus.mu.Lock()
 	w.modemStatus.IsConnected = false
 	w.modemStatus.mu.Unlock()
 
+	w.failPending(errNotConnected)
+
+	w.statsMu.Lock()
 	w.stats.LastDisconnect = time.Now()
-	w.logger.Println("WARN: Disconnected from modem WebSocket")
+	w.statsMu.Unlock()
+	w.logger.Printf("WARN: Disconnected from modem (%s)", w.source)
+	w.recordEvent(eventConnection, fmt.Sprintf("Disconnected from %s: %v", w.source, err), nil)
+}
+
+// Stats returns a snapshot of the connection statistics. Uptime is left to
+// the caller, which knows whether the modem is connected.
+func (w *WebSocketClient) Stats() ConnectionStats {
+	w.statsMu.Lock()
+	lastDisconnect := w.stats.LastDisconnect
+	w.statsMu.Unlock()
+
+	return ConnectionStats{
+		TotalReconnects:  atomic.LoadInt64(&w.stats.TotalReconnects),
+		LastDisconnect:   lastDisconnect,
+		BytesReceived:    atomic.LoadInt64(&w.stats.BytesReceived),
+		MessagesReceived: atomic.LoadInt64(&w.stats.MessagesReceived),
+		Latency:          w.Latency(),
+	}
+}
+
+// Latency returns round-trip statistics when the source measures them
+func (w *WebSocketClient) Latency() *LatencyStats {
+	reporter, ok := w.source.(latencyReporter)
+	if !ok {
+		return nil
+	}
+	stats := reporter.Latency()
+	return &stats
 }
 
 func (w *WebSocketClient) Stop() {
 	close(w.shutdown)
-	if w.conn != nil {
-		w.conn.Close()
-	}
+	w.source.Close()
 }
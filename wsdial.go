@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// headerList collects repeated -modem-header "Name: value" flags
+type headerList []string
+
+func (h *headerList) String() string {
+	// Values may hold secrets; only show the names
+	names := make([]string, 0, len(*h))
+	for _, header := range *h {
+		name, _, _ := strings.Cut(header, ":")
+		names = append(names, strings.TrimSpace(name))
+	}
+	return strings.Join(names, ",")
+}
+
+func (h *headerList) Set(value string) error {
+	name, _, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid header %q (want \"Name: value\")", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// resolveSecret expands "env:NAME" and "file:/path" references so secrets can
+// stay out of the command line. Anything else is used literally. Files are
+// re-read on every connect, which picks up rotated tokens.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return value, nil
+	}
+}
+
+// dialHeaders builds the handshake headers for the modem WebSocket
+func dialHeaders(config *Config) (http.Header, error) {
+	header := http.Header{}
+	for _, h := range config.ModemHeaders {
+		name, value, _ := strings.Cut(h, ":")
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		resolved, err := resolveSecret(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", name, err)
+		}
+		header.Add(name, resolved)
+	}
+
+	if config.ModemToken != "" {
+		token, err := resolveSecret(config.ModemToken)
+		if err != nil {
+			return nil, fmt.Errorf("bearer token: %v", err)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header, nil
+}
+
+// dialTLSConfig builds the TLS settings for wss:// bridges, or nil to use
+// the defaults
+func dialTLSConfig(config *Config) (*tls.Config, error) {
+	if config.ModemCAFile == "" && config.ModemCertFile == "" && !config.ModemInsecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.ModemInsecure,
+	}
+
+	if config.ModemCAFile != "" {
+		pem, err := os.ReadFile(config.ModemCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.ModemCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ModemCertFile != "" {
+		keyFile := config.ModemKeyFile
+		if keyFile == "" {
+			keyFile = config.ModemCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(config.ModemCertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	errNotConnected   = errors.New("modem not connected")
+	errReadOnlySource = errors.New("source does not accept AT commands")
+)
+
+// webSocketSource reaches the modem through a WebSocket bridge
+type webSocketSource struct {
+	config *Config
+	logger *log.Logger
+
+	mu   sync.Mutex // guards conn and done, serializes writes
+	conn *websocket.Conn
+	done chan struct{}
+
+	latency latencyTracker
+}
+
+func newWebSocketSource(config *Config, logger *log.Logger) *webSocketSource {
+	if config.ModemInsecure {
+		logger.Println("WARN: TLS certificate verification for the modem bridge is disabled")
+	}
+	return &webSocketSource{
+		config: config,
+		logger: logger,
+	}
+}
+
+func (s *webSocketSource) String() string {
+	if u, err := url.Parse(s.config.ModemWSURL); err == nil {
+		return "websocket " + u.Redacted()
+	}
+	return "websocket " + s.config.ModemWSURL
+}
+
+func (s *webSocketSource) Connect(ctx context.Context) error {
+	tlsConfig, err := dialTLSConfig(s.config)
+	if err != nil {
+		return err
+	}
+	header, err := dialHeaders(s.config)
+	if err != nil {
+		return err
+	}
+
+	proxyURL, err := modemProxyURL(s.config)
+	if err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout: s.config.RequestTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	if proxyURL != nil {
+		dialer.NetDialContext = proxyDialContext(proxyURL)
+	}
+
+	conn, _, err := dialer.DialContext(ctx, s.config.ModemWSURL, header)
+	if err != nil {
+		var proxyErr *ProxyError
+		if errors.As(err, &proxyErr) {
+			return err
+		}
+		return fmt.Errorf("failed to connect to WebSocket bridge%s: %v", proxyLabel(proxyURL), err)
+	}
+
+	// Pongs measure the round trip and prove the link is alive, so they
+	// also extend the read deadline
+	s.latency.Reset()
+	conn.SetPongHandler(func(payload string) error {
+		s.latency.Pong(payload, time.Now())
+		return conn.SetReadDeadline(time.Now().Add(s.config.PingInterval * 2))
+	})
+
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.conn = conn
+	s.done = done
+	s.mu.Unlock()
+
+	// Start ping goroutine
+	go s.pingHandler(ctx, conn, done)
+
+	return nil
+}
+
+func (s *webSocketSource) ReadFrame() ([]byte, error) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return nil, errNotConnected
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.config.PingInterval * 2))
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("WebSocket read error: %v", err)
+		}
+		if messageType == websocket.TextMessage {
+			return message, nil
+		}
+	}
+}
+
+func (s *webSocketSource) WriteFrame(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return errNotConnected
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.RequestTimeout))
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s *webSocketSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	close(s.done)
+	err := s.conn.Close()
+	s.conn = nil
+	s.done = nil
+	return err
+}
+
+func (s *webSocketSource) pingHandler(ctx context.Context, conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			payload, missed := s.latency.Ping(time.Now())
+			if s.config.MaxMissedPongs > 0 && missed >= s.config.MaxMissedPongs {
+				s.logger.Printf("WARN: %d pongs missed in a row, reconnecting", missed)
+				conn.Close()
+				return
+			}
+
+			s.mu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(s.config.RequestTimeout))
+			err := conn.WriteMessage(websocket.PingMessage, payload)
+			s.mu.Unlock()
+			if err != nil {
+				// Closing the connection fails the pending read, which
+				// hands control back to the reconnect loop
+				s.logger.Printf("Ping error: %v", err)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Latency returns the ping/pong round-trip statistics
+func (s *webSocketSource) Latency() LatencyStats {
+	return s.latency.Stats()
+}